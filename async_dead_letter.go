@@ -0,0 +1,238 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	_defaultAsyncQueueSize     = 1024
+	_defaultAsyncBatchSize     = 100
+	_defaultAsyncFlushInterval = time.Second
+)
+
+var (
+	// ErrDeadLetterQueueFull is returned when the queue of an async deadletter is full and its overflow policy is OverflowReject
+	ErrDeadLetterQueueFull = errors.New("deadletter queue is full")
+	// ErrDeadLetterClosed is returned when a letter is saved to a closed async deadletter
+	ErrDeadLetterClosed = errors.New("deadletter is closed")
+)
+
+// OverflowPolicy decides what an async deadletter does with a letter when its queue is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits until there is room in the queue or the context is done
+	OverflowBlock OverflowPolicy = iota
+	// OverflowReject returns ErrDeadLetterQueueFull without queueing the letter
+	OverflowReject
+	// OverflowDropNewest silently drops the letter that is being saved
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest queued letter to make room for the new one
+	OverflowDropOldest
+)
+
+// AsyncDeadLetter queues letters in memory and saves them to the underlying deadletter in batches from a background goroutine,
+// so a slow deadletter does not block the requests. Close has to be called to flush the queued letters on shutdown
+type AsyncDeadLetter struct {
+	sink          DeadLetterV2
+	queue         chan *Letter
+	batchSize     int
+	flushInterval time.Duration
+	overflow      OverflowPolicy
+	errorHandler  func(err error, letters []*Letter)
+
+	mu      sync.RWMutex
+	closed  bool
+	done    chan struct{}
+	dropped uint64
+}
+
+// AsyncDeadLetterOption is a function that configures an async deadletter
+type AsyncDeadLetterOption func(d *AsyncDeadLetter)
+
+// WithAsyncQueueSize create async deadletter option function with the max number of queued letters,
+// a size less than one keeps the default size
+func WithAsyncQueueSize(size int) AsyncDeadLetterOption {
+	return func(d *AsyncDeadLetter) {
+		if size > 0 {
+			d.queue = make(chan *Letter, size)
+		}
+	}
+}
+
+// WithAsyncBatchSize create async deadletter option function with the max number of letters saved at once,
+// a size less than one keeps the default size
+func WithAsyncBatchSize(size int) AsyncDeadLetterOption {
+	return func(d *AsyncDeadLetter) {
+		if size > 0 {
+			d.batchSize = size
+		}
+	}
+}
+
+// WithAsyncFlushInterval create async deadletter option function with the longest time a letter waits in the queue,
+// a zero or negative interval keeps the default interval
+func WithAsyncFlushInterval(interval time.Duration) AsyncDeadLetterOption {
+	return func(d *AsyncDeadLetter) {
+		if interval > 0 {
+			d.flushInterval = interval
+		}
+	}
+}
+
+// WithAsyncOverflow create async deadletter option function with the overflow policy
+func WithAsyncOverflow(policy OverflowPolicy) AsyncDeadLetterOption {
+	return func(d *AsyncDeadLetter) {
+		d.overflow = policy
+	}
+}
+
+// WithAsyncErrorHandler create async deadletter option function that is called when a batch could not be saved
+func WithAsyncErrorHandler(handler func(err error, letters []*Letter)) AsyncDeadLetterOption {
+	return func(d *AsyncDeadLetter) {
+		d.errorHandler = handler
+	}
+}
+
+// NewAsyncDeadLetter create an async deadletter that saves letters to the given deadletter in the background
+func NewAsyncDeadLetter(sink DeadLetterV2, opts ...AsyncDeadLetterOption) *AsyncDeadLetter {
+	d := &AsyncDeadLetter{
+		sink:          sink,
+		queue:         make(chan *Letter, _defaultAsyncQueueSize),
+		batchSize:     _defaultAsyncBatchSize,
+		flushInterval: _defaultAsyncFlushInterval,
+		done:          make(chan struct{}),
+		errorHandler: func(err error, letters []*Letter) {
+			log.Printf("letters could not saved: %v, letters: %d\n", err, len(letters))
+		},
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	go d.run()
+	return d
+}
+
+// Save queues the letter
+func (d *AsyncDeadLetter) Save(letter *Letter) error {
+	return d.SaveLetters(context.Background(), letter)
+}
+
+// SaveLetters queues the letters according to the overflow policy
+func (d *AsyncDeadLetter) SaveLetters(ctx context.Context, letters ...*Letter) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.closed {
+		return ErrDeadLetterClosed
+	}
+
+	for _, letter := range letters {
+		if err := d.enqueue(ctx, letter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dropped returns the number of letters dropped because the queue was full
+func (d *AsyncDeadLetter) Dropped() uint64 {
+	return atomic.LoadUint64(&d.dropped)
+}
+
+// Close stops accepting letters, saves every queued letter and waits until they are saved
+func (d *AsyncDeadLetter) Close() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		<-d.done
+		return nil
+	}
+	d.closed = true
+	close(d.queue)
+	d.mu.Unlock()
+
+	<-d.done
+	return nil
+}
+
+func (d *AsyncDeadLetter) enqueue(ctx context.Context, letter *Letter) error {
+	select {
+	case d.queue <- letter:
+		return nil
+	default:
+	}
+
+	switch d.overflow {
+	case OverflowReject:
+		return ErrDeadLetterQueueFull
+	case OverflowDropNewest:
+		atomic.AddUint64(&d.dropped, 1)
+		return nil
+	case OverflowDropOldest:
+		for {
+			select {
+			case <-d.queue:
+				atomic.AddUint64(&d.dropped, 1)
+			default:
+			}
+
+			select {
+			case d.queue <- letter:
+				return nil
+			default:
+			}
+		}
+	default:
+		select {
+		case d.queue <- letter:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (d *AsyncDeadLetter) run() {
+	defer close(d.done)
+
+	ticker := time.NewTicker(d.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Letter, 0, d.batchSize)
+	for {
+		select {
+		case letter, ok := <-d.queue:
+			if !ok {
+				d.flush(batch)
+				return
+			}
+			batch = append(batch, letter)
+			if len(batch) >= d.batchSize {
+				d.flush(batch)
+				batch = make([]*Letter, 0, d.batchSize)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				d.flush(batch)
+				batch = make([]*Letter, 0, d.batchSize)
+			}
+		}
+	}
+}
+
+func (d *AsyncDeadLetter) flush(batch []*Letter) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := d.sink.SaveLetters(context.Background(), batch...); err != nil {
+		d.errorHandler(err, batch)
+	}
+}
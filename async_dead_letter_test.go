@@ -0,0 +1,182 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bilginyuksel/client"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/streetbyters/aduket"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingDeadLetter struct {
+	mu      sync.Mutex
+	batches [][]*client.Letter
+	block   chan struct{}
+	entered int32
+	err     error
+}
+
+func (d *recordingDeadLetter) SaveLetters(ctx context.Context, letters ...*client.Letter) error {
+	atomic.AddInt32(&d.entered, 1)
+	if d.block != nil {
+		<-d.block
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.batches = append(d.batches, letters)
+	return d.err
+}
+
+func (d *recordingDeadLetter) batchSizes() []int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var sizes []int
+	for _, batch := range d.batches {
+		sizes = append(sizes, len(batch))
+	}
+	return sizes
+}
+
+func TestAsyncDeadLetter_ReachBatchSize_SaveBatch(t *testing.T) {
+	sink := &recordingDeadLetter{}
+	deadLetter := client.NewAsyncDeadLetter(sink, client.WithAsyncBatchSize(3), client.WithAsyncFlushInterval(time.Hour))
+
+	for i := 0; i < 7; i++ {
+		assert.Nil(t, deadLetter.Save(&client.Letter{Method: http.MethodGet}))
+	}
+	assert.Nil(t, deadLetter.Close())
+
+	assert.Equal(t, []int{3, 3, 1}, sink.batchSizes())
+}
+
+func TestAsyncDeadLetter_FlushInterval_SavePartialBatch(t *testing.T) {
+	sink := &recordingDeadLetter{}
+	deadLetter := client.NewAsyncDeadLetter(sink, client.WithAsyncBatchSize(100), client.WithAsyncFlushInterval(10*time.Millisecond))
+	defer deadLetter.Close()
+
+	assert.Nil(t, deadLetter.SaveLetters(ctx, &client.Letter{}, &client.Letter{}))
+
+	assert.Eventually(t, func() bool {
+		sizes := sink.batchSizes()
+		return len(sizes) == 1 && sizes[0] == 2
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestAsyncDeadLetter_QueueFull_ApplyOverflowPolicy(t *testing.T) {
+	testCases := []struct {
+		scenario        string
+		givenPolicy     client.OverflowPolicy
+		expectedErr     error
+		expectedDropped uint64
+		expectedSaved   int
+	}{
+		{scenario: "reject", givenPolicy: client.OverflowReject, expectedErr: client.ErrDeadLetterQueueFull, expectedSaved: 3},
+		{scenario: "drop newest", givenPolicy: client.OverflowDropNewest, expectedDropped: 1, expectedSaved: 3},
+		{scenario: "drop oldest", givenPolicy: client.OverflowDropOldest, expectedDropped: 1, expectedSaved: 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			sink := &recordingDeadLetter{block: make(chan struct{})}
+			deadLetter := client.NewAsyncDeadLetter(sink,
+				client.WithAsyncQueueSize(2),
+				client.WithAsyncBatchSize(1),
+				client.WithAsyncOverflow(tc.givenPolicy))
+
+			// the first letter is taken by the background goroutine which is blocked by the sink
+			assert.Nil(t, deadLetter.Save(&client.Letter{URL: "0"}))
+			assert.Eventually(t, func() bool { return atomic.LoadInt32(&sink.entered) == 1 }, time.Second, time.Millisecond)
+			assert.Nil(t, deadLetter.Save(&client.Letter{URL: "1"}))
+			assert.Nil(t, deadLetter.Save(&client.Letter{URL: "2"}))
+
+			err := deadLetter.Save(&client.Letter{URL: "3"})
+			assert.Equal(t, tc.expectedErr, err)
+			assert.Equal(t, tc.expectedDropped, deadLetter.Dropped())
+
+			close(sink.block)
+			assert.Nil(t, deadLetter.Close())
+			assert.Len(t, sink.batchSizes(), tc.expectedSaved)
+		})
+	}
+}
+
+func TestAsyncDeadLetter_BlockedUntilContextDone_ReturnContextErr(t *testing.T) {
+	sink := &recordingDeadLetter{block: make(chan struct{})}
+	deadLetter := client.NewAsyncDeadLetter(sink, client.WithAsyncQueueSize(1), client.WithAsyncBatchSize(1))
+
+	assert.Nil(t, deadLetter.Save(&client.Letter{}))
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&sink.entered) == 1 }, time.Second, time.Millisecond)
+	assert.Nil(t, deadLetter.Save(&client.Letter{}))
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	err := deadLetter.SaveLetters(timeoutCtx, &client.Letter{})
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	close(sink.block)
+	assert.Nil(t, deadLetter.Close())
+	assert.Equal(t, client.ErrDeadLetterClosed, deadLetter.Save(&client.Letter{}))
+}
+
+func TestAsyncDeadLetter_SinkFailed_CallErrorHandler(t *testing.T) {
+	sink := &recordingDeadLetter{err: errors.New("error")}
+	var failed []*client.Letter
+	deadLetter := client.NewAsyncDeadLetter(sink, client.WithAsyncErrorHandler(func(err error, letters []*client.Letter) {
+		failed = append(failed, letters...)
+	}))
+
+	assert.Nil(t, deadLetter.Save(&client.Letter{}))
+	assert.Nil(t, deadLetter.Close())
+
+	assert.Len(t, failed, 1)
+}
+
+func TestAdaptDeadLetter_SaveLettersOneByOne(t *testing.T) {
+	mockDeadLetter := client.NewMockDeadLetter(gomock.NewController(t))
+	mockDeadLetter.EXPECT().Save(gomock.Any()).Times(2)
+
+	err := client.AdaptDeadLetter(mockDeadLetter).SaveLetters(ctx, &client.Letter{}, &client.Letter{})
+	assert.Nil(t, err)
+
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	err = client.AdaptDeadLetter(mockDeadLetter).SaveLetters(cancelledCtx, &client.Letter{})
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestDo_WithAsyncDeadLetter_SaveInBackground(t *testing.T) {
+	s, _ := aduket.NewServer(http.MethodGet, "/test", aduket.StatusCode(502))
+	sink := &recordingDeadLetter{}
+	deadLetter := client.NewAsyncDeadLetter(sink)
+
+	cli := client.New(client.WithHost(s.URL), client.WithDeadLetterV2(deadLetter), client.WithRetry(0, time.Millisecond))
+	_, err := cli.Do(ctx, cli.NewRequest().Path("/test"))
+	assert.Nil(t, err)
+	assert.Nil(t, deadLetter.Close())
+
+	assert.Equal(t, []int{1}, sink.batchSizes())
+}
+
+func TestNewAsyncDeadLetter_InvalidOptions_UseDefaults(t *testing.T) {
+	sink := &recordingDeadLetter{}
+	deadLetter := client.NewAsyncDeadLetter(sink,
+		client.WithAsyncQueueSize(-1),
+		client.WithAsyncBatchSize(0),
+		client.WithAsyncFlushInterval(0),
+	)
+
+	assert.Nil(t, deadLetter.Save(&client.Letter{}))
+	assert.Nil(t, deadLetter.Close())
+	assert.Equal(t, []int{1}, sink.batchSizes())
+
+	deadLetter = client.NewAsyncDeadLetter(sink, client.WithAsyncFlushInterval(-time.Second))
+	assert.Nil(t, deadLetter.Close())
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+
+	urlpkg "net/url"
+)
+
+const (
+	// BodyEncodingJSON is the name of the encoder that marshals the body as json
+	BodyEncodingJSON = "json"
+	// BodyEncodingXML is the name of the encoder that marshals the body as xml
+	BodyEncodingXML = "xml"
+	// BodyEncodingForm is the name of the encoder that encodes url.Values as a url encoded form
+	BodyEncodingForm = "form"
+
+	_contentTypeHeader = "Content-Type"
+)
+
+// BodyEncoder marshals a value into a request body
+type BodyEncoder interface {
+	// ContentType is sent as the Content-Type header unless the request already has one
+	ContentType() string
+	Encode(v interface{}) ([]byte, error)
+}
+
+// NewBodyEncoder create a body encoder with the given content type and encode function
+func NewBodyEncoder(contentType string, encode func(v interface{}) ([]byte, error)) BodyEncoder {
+	return &bodyEncoder{contentType: contentType, encode: encode}
+}
+
+type bodyEncoder struct {
+	contentType string
+	encode      func(v interface{}) ([]byte, error)
+}
+
+func (e *bodyEncoder) ContentType() string {
+	return e.contentType
+}
+
+func (e *bodyEncoder) Encode(v interface{}) ([]byte, error) {
+	return e.encode(v)
+}
+
+// defaultBodyEncoders are registered to every client
+func defaultBodyEncoders() map[string]BodyEncoder {
+	return map[string]BodyEncoder{
+		BodyEncodingJSON: NewBodyEncoder("application/json", json.Marshal),
+		BodyEncodingXML:  NewBodyEncoder("application/xml", xml.Marshal),
+		BodyEncodingForm: NewBodyEncoder("application/x-www-form-urlencoded", encodeForm),
+	}
+}
+
+func encodeForm(v interface{}) ([]byte, error) {
+	switch values := v.(type) {
+	case urlpkg.Values:
+		return []byte(values.Encode()), nil
+	case map[string][]string:
+		return []byte(urlpkg.Values(values).Encode()), nil
+	default:
+		return nil, fmt.Errorf("form body has to be url.Values, got %T", v)
+	}
+}
+
+// encodeBody marshals the body value of the request with its encoder, the request has to be a snapshot
+func (c *Client) encodeBody(request *Request) error {
+	contentType := request.bodyContentType
+	if request.bodyEncoding != "" {
+		encoder, ok := c.bodyEncoders[request.bodyEncoding]
+		if !ok {
+			return fmt.Errorf("body encoder %q is not registered", request.bodyEncoding)
+		}
+
+		body, err := encoder.Encode(request.bodyValue)
+		if err != nil {
+			return fmt.Errorf("body could not encoded with %q encoder: %w", request.bodyEncoding, err)
+		}
+		request.body = body
+		contentType = encoder.ContentType()
+	}
+
+	if contentType != "" && request.headers.Get(_contentTypeHeader) == "" {
+		request.headers.Set(_contentTypeHeader, contentType)
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package client_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bilginyuksel/client"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+type capturedBody struct {
+	contentType string
+	body        string
+}
+
+func newBodyServer(captured *capturedBody) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		*captured = capturedBody{contentType: r.Header.Get("Content-Type"), body: string(body)}
+	}))
+}
+
+type order struct {
+	ID    int    `json:"id" xml:"id"`
+	Title string `json:"title" xml:"title"`
+}
+
+func TestDo_TypedBody_EncodeBodyAndSetContentType(t *testing.T) {
+	testCases := []struct {
+		scenario            string
+		givenRequest        func(r *client.Request) *client.Request
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			scenario:            "json",
+			givenRequest:        func(r *client.Request) *client.Request { return r.JSONBody(order{ID: 1, Title: "latte"}) },
+			expectedContentType: "application/json",
+			expectedBody:        `{"id":1,"title":"latte"}`,
+		},
+		{
+			scenario:            "xml",
+			givenRequest:        func(r *client.Request) *client.Request { return r.XMLBody(order{ID: 1, Title: "latte"}) },
+			expectedContentType: "application/xml",
+			expectedBody:        `<order><id>1</id><title>latte</title></order>`,
+		},
+		{
+			scenario: "form",
+			givenRequest: func(r *client.Request) *client.Request {
+				return r.FormBody(url.Values{"id": {"1"}, "title": {"latte"}})
+			},
+			expectedContentType: "application/x-www-form-urlencoded",
+			expectedBody:        "id=1&title=latte",
+		},
+		{
+			scenario: "content type given by the caller",
+			givenRequest: func(r *client.Request) *client.Request {
+				return r.JSONBody(order{ID: 1}).SetHeader("Content-Type", "application/vnd.order+json")
+			},
+			expectedContentType: "application/vnd.order+json",
+			expectedBody:        `{"id":1,"title":""}`,
+		},
+		{
+			scenario:     "raw body replaces the typed body",
+			givenRequest: func(r *client.Request) *client.Request { return r.JSONBody(order{ID: 1}).Body([]byte("raw")) },
+			expectedBody: "raw",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			var captured capturedBody
+			s := newBodyServer(&captured)
+			defer s.Close()
+
+			cli := client.New(client.WithHost(s.URL))
+			_, err := cli.Do(ctx, tc.givenRequest(cli.NewRequest().Method(http.MethodPost)))
+
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expectedContentType, captured.contentType)
+			assert.Equal(t, tc.expectedBody, captured.body)
+		})
+	}
+}
+
+func TestDo_JSONBodyEncodedLazily_SendValueAtSendTime(t *testing.T) {
+	var captured capturedBody
+	s := newBodyServer(&captured)
+	defer s.Close()
+
+	cli := client.New(client.WithHost(s.URL))
+	body := &order{ID: 1}
+	request := cli.NewRequest().Method(http.MethodPost).JSONBody(body)
+	body.Title = "mocha"
+	_, err := cli.Do(ctx, request)
+
+	assert.Nil(t, err)
+	assert.Equal(t, `{"id":1,"title":"mocha"}`, captured.body)
+}
+
+func TestDo_BodyEncodingFails_ReturnErrWithoutSending(t *testing.T) {
+	var count int
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		count++
+	}))
+	defer s.Close()
+
+	cli := client.New(client.WithHost(s.URL), client.WithRetry(0, time.Millisecond))
+
+	_, err := cli.Do(ctx, cli.NewRequest().Method(http.MethodPost).JSONBody(make(chan int)))
+	assert.NotNil(t, err)
+
+	_, err = cli.Do(ctx, cli.NewRequest().Method(http.MethodPost).FormBody(nil).EncodedBody("yaml", "a: b"))
+	assert.EqualError(t, err, `body encoder "yaml" is not registered`)
+
+	assert.Equal(t, 0, count)
+}
+
+func TestDo_WithBodyEncoder_UseRegisteredEncoder(t *testing.T) {
+	var captured capturedBody
+	s := newBodyServer(&captured)
+	defer s.Close()
+
+	encodeErr := errors.New("not a string")
+	cli := client.New(client.WithHost(s.URL), client.WithBodyEncoder("text", client.NewBodyEncoder("text/plain", func(v interface{}) ([]byte, error) {
+		text, ok := v.(string)
+		if !ok {
+			return nil, encodeErr
+		}
+		return []byte(text), nil
+	})))
+
+	_, err := cli.Do(ctx, cli.NewRequest().Method(http.MethodPost).EncodedBody("text", "hello"))
+	assert.Nil(t, err)
+	assert.Equal(t, capturedBody{contentType: "text/plain", body: "hello"}, captured)
+
+	_, err = cli.Do(ctx, cli.NewRequest().Method(http.MethodPost).EncodedBody("text", 1))
+	assert.ErrorIs(t, err, encodeErr)
+}
+
+func TestDo_BodyReader_StreamBodyAndReopenOnRetry(t *testing.T) {
+	type received struct {
+		contentLength int64
+		body          string
+	}
+	var (
+		mu       sync.Mutex
+		requests []received
+	)
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, received{contentLength: r.ContentLength, body: string(body)})
+		if len(requests) == 1 {
+			rw.WriteHeader(503)
+		}
+	}))
+	defer s.Close()
+
+	path := filepath.Join(t.TempDir(), "upload.bin")
+	assert.Nil(t, os.WriteFile(path, []byte("large upload"), 0o644))
+
+	var opened int32
+	cli := client.New(client.WithHost(s.URL), client.WithRetry(1, time.Millisecond))
+	res, err := cli.Do(ctx, cli.NewRequest().Method(http.MethodPut).BodyReader(func() (io.ReadCloser, error) {
+		atomic.AddInt32(&opened, 1)
+		return os.Open(path)
+	}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&opened))
+	assert.Equal(t, []received{{contentLength: 12, body: "large upload"}, {contentLength: 12, body: "large upload"}}, requests)
+}
+
+func TestDo_BodyReaderWithUnknownLength_SendChunkedBody(t *testing.T) {
+	var captured capturedBody
+	var contentLength int64
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		contentLength = r.ContentLength
+		captured = capturedBody{body: string(body)}
+	}))
+	defer s.Close()
+
+	cli := client.New(client.WithHost(s.URL))
+	_, err := cli.Do(ctx, cli.NewRequest().Method(http.MethodPost).BodyReader(func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader("chunked")), nil
+	}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), contentLength)
+	assert.Equal(t, "chunked", captured.body)
+}
+
+func TestDo_BodyReaderFails_ReturnErr(t *testing.T) {
+	openErr := errors.New("could not open")
+	cli := client.New(client.WithHost("http://localhost:1"))
+
+	_, err := cli.Do(ctx, cli.NewRequest().Method(http.MethodPost).BodyReader(func() (io.ReadCloser, error) {
+		return nil, openErr
+	}))
+
+	assert.ErrorIs(t, err, openErr)
+}
+
+func TestDo_BodyStream_SendOnceAndFailDeadLettering(t *testing.T) {
+	var count int32
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		rw.WriteHeader(500)
+	}))
+	defer s.Close()
+
+	cli := client.New(client.WithHost(s.URL), client.WithRetry(2, time.Millisecond))
+	request := cli.NewRequest().Method(http.MethodPut).BodyStream(strings.NewReader("stream"))
+	res, err := cli.Do(ctx, request)
+	assert.Nil(t, err)
+	assert.Equal(t, 500, res.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+
+	_, err = cli.Do(ctx, request)
+	assert.ErrorIs(t, err, client.ErrBodyNotRewindable)
+
+	mockDeadLetter := client.NewMockDeadLetter(gomock.NewController(t))
+	cli = client.New(client.WithHost(s.URL), client.WithDeadLetter(mockDeadLetter), client.WithRetry(2, time.Millisecond))
+	_, err = cli.Do(ctx, cli.NewRequest().Method(http.MethodPut).BodyStream(strings.NewReader("stream")))
+	assert.ErrorIs(t, err, client.ErrBodyNotRewindable)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+}
+
+func TestDo_LargeBodyReaderDeadLettered_KeepOnlyBeginningOfBody(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		rw.WriteHeader(500)
+	}))
+	defer s.Close()
+
+	var letter *client.Letter
+	mockDeadLetter := client.NewMockDeadLetter(gomock.NewController(t))
+	mockDeadLetter.EXPECT().Save(gomock.Any()).Do(func(l *client.Letter) { letter = l })
+
+	cli := client.New(client.WithHost(s.URL), client.WithDeadLetter(mockDeadLetter), client.WithRetry(0, time.Millisecond))
+	_, err := cli.Do(ctx, cli.NewRequest().Method(http.MethodPut).BodyReader(func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(strings.Repeat("a", 1<<20))), nil
+	}))
+
+	assert.Nil(t, err)
+	assert.True(t, letter.BodyTruncated)
+	assert.Len(t, letter.Body, 64<<10)
+
+	_, err = cli.NewRequestFromLetter(letter)
+	assert.ErrorIs(t, err, client.ErrLetterBodyTruncated)
+}
@@ -5,11 +5,12 @@ import (
 	"context"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"golang.org/x/time/rate"
@@ -18,6 +19,18 @@ import (
 const (
 	_defaultMaxRetry      = 3
 	_defaultRetryInterval = 1000 * time.Millisecond
+	_defaultMaxRetryAfter = 30 * time.Second
+	_defaultRetryHeader   = "X-Retry"
+
+	// _maxLetterResponseBody is the maximum number of response body bytes kept in a letter
+	_maxLetterResponseBody = 4 << 10
+
+	// _maxLetterStreamedBody is the maximum number of streamed request body bytes kept in a letter
+	_maxLetterStreamedBody = 64 << 10
+
+	// _maxDrainBytes is the maximum number of bytes read from a discarded response body
+	// to let the connection go back to the pool, larger bodies are closed without reading
+	_maxDrainBytes = 64 << 10
 
 	_retryIntervalCoef = 1.5
 )
@@ -27,20 +40,32 @@ const (
 // Provides a deadletter to save requests that could not be sent
 // and a rate limiter to limit the number of requests per second
 type Client struct {
-	httpClient    *http.Client
-	host          string
-	maxRetry      int
-	retryInterval time.Duration
-	deadLetter    DeadLetter
-	rateLimiter   *rate.Limiter
+	httpClient         *http.Client
+	host               string
+	retryPolicy        RetryPolicy
+	maxRetryAfter      time.Duration
+	retryHeader        string
+	retryBudget        *RetryBudget
+	hedging            *hedging
+	bodyEncoders       map[string]BodyEncoder
+	successStatusCodes []int
+	newError           func() error
+	deadLetter         DeadLetterV2
+	saveLetterIf       DeadLetterPredicate
+	redaction          *RedactionPolicy
+	letterKey          []byte
+	rateLimiter        *rate.Limiter
 }
 
 // New create a client with multiple options or get the default client without providing any options
 func New(opts ...Option) *Client {
 	cli := &Client{
 		httpClient:    &http.Client{},
-		maxRetry:      _defaultMaxRetry,
-		retryInterval: _defaultRetryInterval,
+		retryPolicy:   NewExponentialRetryPolicy(_defaultMaxRetry, _defaultRetryInterval, _retryIntervalCoef),
+		maxRetryAfter: _defaultMaxRetryAfter,
+		retryHeader:   _defaultRetryHeader,
+		bodyEncoders:  defaultBodyEncoders(),
+		saveLetterIf:  DefaultDeadLetterPredicate,
 	}
 
 	for _, opt := range opts {
@@ -52,22 +77,22 @@ func New(opts ...Option) *Client {
 
 // PutJSON execute a put method with the given request and then unmarshal the json response body
 func (c *Client) PutJSON(ctx context.Context, request *Request, response interface{}) error {
-	return c.ParseJSON(ctx, request.Method(http.MethodPut), response)
+	return c.parse(ctx, request, http.MethodPut, response, json.Unmarshal)
 }
 
 // PostJSON execute a post method with the given request and then unmarshal the json response body
 func (c *Client) PostJSON(ctx context.Context, request *Request, response interface{}) error {
-	return c.ParseJSON(ctx, request.Method(http.MethodPost), response)
+	return c.parse(ctx, request, http.MethodPost, response, json.Unmarshal)
 }
 
 // GetJSON execute a get method with the given request and then unmarshal the json response body
 func (c *Client) GetJSON(ctx context.Context, request *Request, response interface{}) error {
-	return c.ParseJSON(ctx, request.Method(http.MethodGet), response)
+	return c.parse(ctx, request, http.MethodGet, response, json.Unmarshal)
 }
 
 // GetXML execute a get method with the given request and then unmarshal the xml response body
 func (c *Client) GetXML(ctx context.Context, request *Request, response interface{}) error {
-	return c.ParseXML(ctx, request.Method(http.MethodGet), response)
+	return c.parse(ctx, request, http.MethodGet, response, xml.Unmarshal)
 }
 
 // ParseJSON send a request with given request properties
@@ -84,11 +109,26 @@ func (c *Client) ParseXML(ctx context.Context, request *Request, response interf
 
 // Parse send a request with the given request properties
 // Read the body with the given parser function
+// If the status code is not a success an *HTTPError is returned and the body is decoded into the error type instead
 func (c *Client) Parse(ctx context.Context, request *Request, response interface{}, parser func(bodyBytes []byte, response interface{}) error) error {
-	res, err := c.Do(ctx, request)
+	return c.parse(ctx, request, "", response, parser)
+}
+
+// parse sends the request with the given method instead of the method of the request if it is not empty
+func (c *Client) parse(ctx context.Context, request *Request, method string, response interface{}, parser func(bodyBytes []byte, response interface{}) error) error {
+	res, err := c.send(ctx, request, method)
 	if err != nil {
+		closeResponse(res)
 		return err
 	}
+	if !c.isSuccess(res.StatusCode) {
+		httpErr, body := newHTTPError(request, res)
+		if method != "" && res.Request == nil {
+			httpErr.Method = method
+		}
+		httpErr.Err = c.decodeErrorBody(request, httpErr, body)
+		return httpErr
+	}
 	defer res.Body.Close()
 
 	responseBytes, err := io.ReadAll(res.Body)
@@ -100,21 +140,42 @@ func (c *Client) Parse(ctx context.Context, request *Request, response interface
 
 // Do Execute an http request with the given request
 func (c *Client) Do(ctx context.Context, request *Request) (res *http.Response, err error) {
+	return c.send(ctx, request, "")
+}
+
+// send sends a snapshot of the request, the method of the snapshot is replaced with the given method if it is not empty,
+// so the request of the caller is never changed and can be shared
+func (c *Client) send(ctx context.Context, request *Request, method string) (res *http.Response, err error) {
 	if err := c.awaitRateLimiter(ctx); err != nil {
 		return nil, err
 	}
 
-	res, err = c.do(ctx, request, 1)
+	request, err = request.snapshot()
 	if err != nil {
 		return nil, err
 	}
+	if method != "" {
+		request.method = method
+	}
+	if err := c.encodeBody(request); err != nil {
+		return nil, err
+	}
+
+	if c.retryBudget != nil {
+		c.retryBudget.recordRequest()
+	}
+
+	if h := c.hedgingFor(request); h != nil && h.maxHedges > 0 && request.retryable() {
+		res, err = c.doHedged(ctx, request, h)
+	} else {
+		res, err = c.do(ctx, request, 1)
+	}
 
-	// if still 5XX server error then we need to record this request to ensure consistency
-	if res.StatusCode >= 500 && res.StatusCode <= 599 {
-		url, _ := request.URL()
-		if err := c.saveRequest(request, url); err != nil {
-			log.Printf("request could not send to deadletter: %v, request: %v\n", err, request)
-			return res, fmt.Errorf("letter could not saved: %v", err)
+	// by default if still 5XX server error, 429 too many requests or the client gave up retrying then we need to record this request to ensure consistency
+	if c.saveLetterIf(request, res, err) {
+		if err := c.saveRequest(ctx, request, res, err); err != nil {
+			log.Printf("request could not send to deadletter: %v, method: %s, url: %s\n", err, request.method, c.redactedURL(request))
+			return res, fmt.Errorf("letter could not saved: %w", err)
 		}
 	}
 
@@ -122,60 +183,294 @@ func (c *Client) Do(ctx context.Context, request *Request) (res *http.Response,
 }
 
 func (c *Client) do(ctx context.Context, request *Request, retryCount int) (res *http.Response, err error) {
-	req, err := c.prepareRequest(ctx, request)
+	attemptCtx, cancel := request.attemptContext(ctx)
+	req, err := c.prepareRequest(attemptCtx, request, retryCount)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 
+	request.attempts.record()
 	res, err = c.httpClient.Do(req)
+	if err != nil && ctx.Err() == nil && attemptCtx.Err() != nil {
+		err = fmt.Errorf("%w: %v", ErrAttemptTimeout, err)
+	}
+
+	if request.retryable() && c.retryPolicyFor(request).ShouldRetry(retryCount, res, err) {
+		if c.retryBudget != nil && !c.retryBudget.allowRetry() {
+			closeResponse(res)
+			cancel()
+			return nil, &RetryError{Attempts: retryCount, StatusCode: statusCode(res), LastErr: err, Err: ErrRetryBudgetExhausted}
+		}
+		if waitErr := wait(ctx, c.retryDelay(request, retryCount, res, err)); waitErr != nil {
+			closeResponse(res)
+			cancel()
+			return nil, &RetryError{Attempts: retryCount, StatusCode: statusCode(res), LastErr: err, Err: waitErr}
+		}
+		closeResponse(res)
+		cancel()
+		return c.do(ctx, request, retryCount+1)
+	}
+
 	if err != nil {
+		cancel()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			reason := ctxErr
+			if errors.Is(ctxErr, context.DeadlineExceeded) {
+				reason = ErrRetryDeadline
+			}
+			return nil, &RetryError{Attempts: retryCount, LastErr: err, Err: reason}
+		}
+		if isTransientError(err) {
+			reason := ErrRetriesExhausted
+			if !request.retryable() {
+				reason = ErrNotRetryable
+			}
+			return nil, &RetryError{Attempts: retryCount, LastErr: err, Err: reason}
+		}
 		return nil, err
 	}
 
-	if c.shouldRetry(retryCount, res.StatusCode) {
-		computedRetryInterval := float64(c.retryInterval.Milliseconds()) * math.Pow(_retryIntervalCoef, float64(retryCount))
-		time.Sleep(time.Millisecond * time.Duration(computedRetryInterval))
-		req.Header.Set("X-Retry", fmt.Sprintf("%d", retryCount))
-		return c.do(ctx, request, retryCount+1)
+	// the attempt context must live until the caller finishes reading the body
+	res.Body = &cancelOnCloseBody{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+func (c *Client) retryPolicyFor(request *Request) RetryPolicy {
+	if request.retryPolicy != nil {
+		return request.retryPolicy
 	}
+	return c.retryPolicy
+}
 
-	return res, err
+func (c *Client) deadLetterFor(request *Request) DeadLetterV2 {
+	if request.skipDeadLetter {
+		return nil
+	}
+	if request.deadLetter != nil {
+		return request.deadLetter
+	}
+	return c.deadLetter
 }
 
-func (c *Client) shouldRetry(retryCount int, statusCode int) bool {
-	return retryCount <= c.maxRetry && statusCode >= 500 && statusCode <= 599
+// retryDelay prefers the Retry-After header of the response over the delay of the retry policy
+func (c *Client) retryDelay(request *Request, retryCount int, res *http.Response, err error) time.Duration {
+	if retryAfter, ok := parseRetryAfter(res); ok {
+		if retryAfter > c.maxRetryAfter {
+			return c.maxRetryAfter
+		}
+		return retryAfter
+	}
+	return c.retryPolicyFor(request).Delay(retryCount, res, err)
+}
+
+// DeadLetterPredicate decides whether a request is saved to the deadletter after it is sent for the last time
+type DeadLetterPredicate func(request *Request, res *http.Response, err error) bool
+
+// DefaultDeadLetterPredicate saves the requests that still get 5XX or 429 after the retries,
+// and the requests the client gave up, including the requests whose context is done while an attempt is in flight
+func DefaultDeadLetterPredicate(request *Request, res *http.Response, err error) bool {
+	var retryErr *RetryError
+	if errors.As(err, &retryErr) {
+		return true
+	}
+	return err == nil && isRetryable(res, nil)
 }
 
-func (c *Client) saveRequest(req *Request, url string) error {
-	if c.deadLetter == nil {
+// DeadLetterStatusCodes create a deadletter predicate that saves the requests answered with one of the given
+// status codes in addition to the requests the default predicate saves, such as 409 or 422
+func DeadLetterStatusCodes(statusCodes ...int) DeadLetterPredicate {
+	return func(request *Request, res *http.Response, err error) bool {
+		if err == nil && res != nil {
+			for _, statusCode := range statusCodes {
+				if res.StatusCode == statusCode {
+					return true
+				}
+			}
+		}
+		return DefaultDeadLetterPredicate(request, res, err)
+	}
+}
+
+// saveRequest sends the request to the deadletter with the context of the request.
+// If the context is already done the letter is saved with a context that is never cancelled, so it is not lost
+func (c *Client) saveRequest(ctx context.Context, req *Request, res *http.Response, resErr error) error {
+	deadLetter := c.deadLetterFor(req)
+	if deadLetter == nil {
 		return nil
 	}
 
-	return c.deadLetter.Save(&Letter{
-		Method:  req.method,
-		Body:    req.body,
-		Headers: req.headers,
-		URL:     url,
-	})
+	id, err := newUUID()
+	if err != nil {
+		return err
+	}
+
+	body, bodyTruncated, err := req.letterBody(_maxLetterStreamedBody)
+	if err != nil {
+		return err
+	}
+
+	url, _ := req.URL()
+	attempts, firstAttemptAt, lastAttemptAt := req.attempts.stats()
+	letter := &Letter{
+		ID:             id,
+		Method:         req.method,
+		Body:           body,
+		BodyTruncated:  bodyTruncated,
+		Headers:        req.headers,
+		URL:            url,
+		Tags:           req.tags,
+		Attempts:       attempts,
+		FirstAttemptAt: firstAttemptAt,
+		LastAttemptAt:  lastAttemptAt,
+		StatusCode:     statusCode(res),
+		ResponseBody:   peekBody(res, _maxLetterResponseBody),
+		CreatedAt:      time.Now(),
+	}
+
+	var retryErr *RetryError
+	if errors.As(resErr, &retryErr) {
+		letter.StatusCode = retryErr.StatusCode
+	}
+	if resErr != nil {
+		letter.Error = resErr.Error()
+	}
+
+	if c.redaction != nil {
+		c.redaction.apply(letter)
+	}
+	if c.letterKey != nil {
+		if err := EncryptLetter(letter, c.letterKey); err != nil {
+			return err
+		}
+	}
+
+	if ctx.Err() != nil {
+		ctx = detachedContext{Context: ctx}
+	}
+	return deadLetter.SaveLetters(ctx, letter)
+}
+
+// redactedURL returns the url of the request with the query parameters of the redaction policy masked
+func (c *Client) redactedURL(request *Request) string {
+	url, _ := request.URL()
+	if c.redaction == nil {
+		return url
+	}
+	return c.redaction.redactURL(url)
 }
 
-func (c *Client) prepareRequest(ctx context.Context, request *Request) (*http.Request, error) {
+func (c *Client) prepareRequest(ctx context.Context, request *Request, retryCount int) (*http.Request, error) {
 	url, err := request.URL()
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, request.method, url, bytes.NewBuffer(request.body))
+	if request.bodyFactory == nil {
+		req, err := http.NewRequestWithContext(ctx, request.method, url, bytes.NewBuffer(request.body))
+		if err != nil {
+			return nil, err
+		}
+		return c.prepareHeaders(req, request, retryCount), nil
+	}
+
+	body, err := request.openBody()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, request.method, url, body)
 	if err != nil {
+		body.Close()
 		return nil, err
 	}
-	req.Header = request.headers
+	switch length := contentLength(body); {
+	case length == 0:
+		body.Close()
+		req.Body = http.NoBody
+	case length > 0:
+		req.ContentLength = length
+	}
+	if !request.bodyOnce {
+		req.GetBody = request.openBody
+	}
+	return c.prepareHeaders(req, request, retryCount), nil
+}
+
+func (c *Client) prepareHeaders(req *http.Request, request *Request, retryCount int) *http.Request {
+	req.Header = request.headers.Clone()
+	if c.retryHeader != "" && retryCount > 1 {
+		req.Header.Set(c.retryHeader, strconv.Itoa(retryCount-1))
+	}
 
 	for _, manipulator := range request.manipulators {
 		manipulator(req)
 	}
 
-	return req, nil
+	return req
+}
+
+func statusCode(res *http.Response) int {
+	if res == nil {
+		return 0
+	}
+	return res.StatusCode
+}
+
+// peekBody reads the beginning of the response body without consuming it for the caller
+func peekBody(res *http.Response, n int64) []byte {
+	if res == nil {
+		return nil
+	}
+
+	prefix, err := io.ReadAll(io.LimitReader(res.Body, n))
+	res.Body = &peekedBody{
+		Reader: io.MultiReader(bytes.NewReader(prefix), &errReader{err: err}, res.Body),
+		Closer: res.Body,
+	}
+	if len(prefix) == 0 {
+		return nil
+	}
+	return prefix
+}
+
+// peekedBody is a response body whose beginning is already read
+type peekedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// errReader returns the error that happened while peeking once the peeked bytes are consumed
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	return 0, io.EOF
+}
+
+// closeResponse drains and closes the body of a discarded response so its connection can be reused
+func closeResponse(res *http.Response) {
+	if res == nil {
+		return
+	}
+
+	_, _ = io.CopyN(io.Discard, res.Body, _maxDrainBytes)
+	res.Body.Close()
+}
+
+// cancelOnCloseBody cancels the context of the attempt when the response body is closed
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
 }
 
 func (c *Client) awaitRateLimiter(ctx context.Context) error {
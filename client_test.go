@@ -4,8 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -168,15 +173,17 @@ func TestDo_5XXStatusCode_RetryIntervalShouldIncreaseExponentialy(t *testing.T)
 func TestDo_ReachMaxRetry_SaveRequestToDeadLetter(t *testing.T) {
 	s, _ := aduket.NewServer(http.MethodGet, "/test", aduket.StatusCode(502))
 
+	var letter *client.Letter
 	mockDeadLetter := client.NewMockDeadLetter(gomock.NewController(t))
-	mockDeadLetter.EXPECT().Save(&client.Letter{
-		Method:  "GET",
-		URL:     fmt.Sprintf("%s/test", s.URL),
-		Headers: map[string][]string{"X-Retry": {"3"}},
-	})
+	mockDeadLetter.EXPECT().Save(gomock.Any()).Do(func(l *client.Letter) { letter = l })
 
 	cli := client.New(client.WithHost(s.URL), client.WithDeadLetter(mockDeadLetter), client.WithRetry(3, 1*time.Millisecond))
 	_, _ = cli.Do(ctx, cli.NewRequest().Path("/test"))
+
+	assert.Equal(t, "GET", letter.Method)
+	assert.Equal(t, fmt.Sprintf("%s/test", s.URL), letter.URL)
+	assert.Equal(t, map[string][]string{}, letter.Headers)
+	assert.WithinDuration(t, time.Now(), letter.CreatedAt, time.Second)
 }
 
 func TestDo_SaveDeadLetterFailedAfterReachingMaxRetry_ReturnErr(t *testing.T) {
@@ -255,3 +262,332 @@ func TestDo_InvalidHost_ReturnErr(t *testing.T) {
 
 	assert.NotNil(t, err)
 }
+
+func TestDo_NonIdempotentMethod_DoNotRetry(t *testing.T) {
+	var count int
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		count++
+		rw.WriteHeader(500)
+	}))
+
+	cli := client.New(client.WithHost(s.URL), client.WithRetry(3, time.Millisecond))
+	_, _ = cli.Do(ctx, cli.NewRequest().Method(http.MethodPost))
+
+	assert.Equal(t, 1, count)
+}
+
+func TestDo_IdempotentRequest_RetryWithSameIdempotencyKey(t *testing.T) {
+	var idempotencyKeys []string
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		idempotencyKeys = append(idempotencyKeys, r.Header.Get("Idempotency-Key"))
+		rw.WriteHeader(500)
+	}))
+
+	var letter *client.Letter
+	mockDeadLetter := client.NewMockDeadLetter(gomock.NewController(t))
+	mockDeadLetter.EXPECT().Save(gomock.Any()).Do(func(l *client.Letter) { letter = l })
+
+	cli := client.New(client.WithHost(s.URL), client.WithDeadLetter(mockDeadLetter), client.WithRetry(2, time.Millisecond))
+	req := cli.NewRequest().Method(http.MethodPost).Idempotent()
+	_, _ = cli.Do(ctx, req)
+
+	assert.Len(t, idempotencyKeys, 3)
+	assert.NotEmpty(t, idempotencyKeys[0])
+	assert.Equal(t, idempotencyKeys[0], idempotencyKeys[1])
+	assert.Equal(t, idempotencyKeys[0], idempotencyKeys[2])
+	assert.Equal(t, idempotencyKeys[0], http.Header(letter.Headers).Get("Idempotency-Key"))
+}
+
+func TestDo_IdempotencyKey_SendGivenKey(t *testing.T) {
+	var count int
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		count++
+		assert.Equal(t, "order-1", r.Header.Get("Idempotency-Key"))
+		rw.WriteHeader(500)
+	}))
+
+	cli := client.New(client.WithHost(s.URL), client.WithRetry(1, time.Millisecond))
+	_, _ = cli.Do(ctx, cli.NewRequest().Method(http.MethodPatch).IdempotencyKey("order-1"))
+
+	assert.Equal(t, 2, count)
+}
+
+func TestDo_IdempotentRequestWithIdempotencyKeyHeader_KeepHeader(t *testing.T) {
+	var count int32
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		assert.Equal(t, "mine", r.Header.Get("Idempotency-Key"))
+		rw.WriteHeader(500)
+	}))
+
+	cli := client.New(client.WithHost(s.URL), client.WithRetry(1, time.Millisecond))
+	_, _ = cli.Do(ctx, cli.NewRequest().Method(http.MethodPost).SetHeader("Idempotency-Key", "mine").Idempotent())
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+}
+
+func TestDo_RequestRetryOverride_UseRequestRetryInsteadOfClient(t *testing.T) {
+	var count int
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		count++
+		rw.WriteHeader(500)
+	}))
+
+	cli := client.New(client.WithHost(s.URL), client.WithRetry(3, time.Millisecond))
+	_, _ = cli.Do(ctx, cli.NewRequest().Retry(1, time.Millisecond))
+	assert.Equal(t, 2, count)
+
+	count = 0
+	_, _ = cli.Do(ctx, cli.NewRequest().RetryPolicy(client.NewConstantRetryPolicy(0, time.Millisecond)))
+	assert.Equal(t, 1, count)
+}
+
+func TestDo_RequestTimeout_RetryTimedOutAttempt(t *testing.T) {
+	var count int32
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) == 1 {
+			time.Sleep(200 * time.Millisecond)
+		}
+		_, _ = rw.Write([]byte("hello"))
+	}))
+
+	cli := client.New(client.WithHost(s.URL), client.WithRetry(1, time.Millisecond))
+	res, err := cli.Do(ctx, cli.NewRequest().Timeout(50*time.Millisecond))
+
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+	body, err := io.ReadAll(res.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(body))
+	assert.Nil(t, res.Body.Close())
+}
+
+func TestDo_RequestDeadLetterOverride_SaveToRequestDeadLetter(t *testing.T) {
+	s, _ := aduket.NewServer(http.MethodGet, "/test", aduket.StatusCode(502))
+
+	clientDeadLetter := client.NewMockDeadLetter(gomock.NewController(t))
+	requestDeadLetter := client.NewMockDeadLetter(gomock.NewController(t))
+	requestDeadLetter.EXPECT().Save(gomock.Any())
+
+	cli := client.New(client.WithHost(s.URL), client.WithDeadLetter(clientDeadLetter), client.WithRetry(0, time.Millisecond))
+	_, err := cli.Do(ctx, cli.NewRequest().Path("/test").DeadLetter(requestDeadLetter))
+
+	assert.Nil(t, err)
+}
+
+func TestDo_SkipDeadLetter_DoNotSaveRequest(t *testing.T) {
+	s, _ := aduket.NewServer(http.MethodGet, "/test", aduket.StatusCode(502))
+
+	clientDeadLetter := client.NewMockDeadLetter(gomock.NewController(t))
+
+	cli := client.New(client.WithHost(s.URL), client.WithDeadLetter(clientDeadLetter), client.WithRetry(0, time.Millisecond))
+	_, err := cli.Do(ctx, cli.NewRequest().Path("/test").SkipDeadLetter())
+
+	assert.Nil(t, err)
+}
+
+func TestDo_RetryManyRequests_ReuseConnections(t *testing.T) {
+	var newConnections int32
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(500)
+		_, _ = rw.Write([]byte(strings.Repeat("internal server error", 1500)))
+	}))
+	s.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&newConnections, 1)
+		}
+	}
+	s.Start()
+	defer s.Close()
+
+	cli := client.New(client.WithHost(s.URL),
+		client.WithHTTPClient(&http.Client{Transport: &http.Transport{}}),
+		client.WithRetry(3, time.Millisecond))
+
+	for i := 0; i < 50; i++ {
+		res, err := cli.Do(ctx, cli.NewRequest())
+		assert.Nil(t, err)
+		_, _ = io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&newConnections))
+}
+
+func TestDo_RetriedRequest_DoNotModifyCallerRequest(t *testing.T) {
+	s, _ := aduket.NewServer(http.MethodGet, "/test", aduket.StatusCode(500))
+	cli := client.New(client.WithHost(s.URL), client.WithRetry(2, time.Millisecond))
+
+	req := cli.NewRequest().Path("/test").AddHeader("X-R", "req").Idempotent()
+	_, _ = cli.Do(ctx, req)
+	_, _ = cli.Do(ctx, req)
+
+	secondReq := cli.NewRequest().Path("/test").AddHeader("X-R", "req").Idempotent()
+	assert.Equal(t, secondReq, req)
+}
+
+func TestDo_WithRetryHeader_UseGivenHeaderName(t *testing.T) {
+	var retryHeaders, defaultRetryHeaders []string
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		retryHeaders = append(retryHeaders, r.Header.Get("X-Attempt-Retry"))
+		defaultRetryHeaders = append(defaultRetryHeaders, r.Header.Get("X-Retry"))
+		rw.WriteHeader(500)
+	}))
+
+	cli := client.New(client.WithHost(s.URL), client.WithRetry(2, time.Millisecond), client.WithRetryHeader("X-Attempt-Retry"))
+	_, _ = cli.Do(ctx, cli.NewRequest())
+
+	assert.Equal(t, []string{"", "1", "2"}, retryHeaders)
+	assert.Equal(t, []string{"", "", ""}, defaultRetryHeaders)
+}
+
+func TestDo_EmptyRetryHeader_DoNotSendRetryHeader(t *testing.T) {
+	var retryHeaders []string
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		retryHeaders = append(retryHeaders, r.Header.Get("X-Retry"))
+		rw.WriteHeader(500)
+	}))
+
+	cli := client.New(client.WithHost(s.URL), client.WithRetry(2, time.Millisecond), client.WithRetryHeader(""))
+	_, _ = cli.Do(ctx, cli.NewRequest())
+
+	assert.Equal(t, []string{"", "", ""}, retryHeaders)
+}
+
+func TestDo_SharedRequestFromManyGoroutines_SendEveryRequest(t *testing.T) {
+	var count int32
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		if r.Header.Get("X-Retry") == "" {
+			rw.WriteHeader(500)
+			return
+		}
+		_, _ = rw.Write([]byte("{}"))
+	}))
+
+	cli := client.New(client.WithHost(s.URL), client.WithRetry(3, time.Millisecond))
+	req := cli.NewRequest().AddHeader("X-R", "req").SetBasicAuth("test", "test").Idempotent()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := cli.Do(ctx, req)
+			if assert.Nil(t, err) {
+				res.Body.Close()
+			}
+		}()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, cli.GetJSON(ctx, req, &struct{}{}))
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(80), atomic.LoadInt32(&count))
+}
+
+func TestDo_ReachMaxRetry_SaveFailureDetailsToLetter(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(503)
+		_, _ = rw.Write([]byte(strings.Repeat("a", 10000)))
+	}))
+
+	var letter *client.Letter
+	mockDeadLetter := client.NewMockDeadLetter(gomock.NewController(t))
+	mockDeadLetter.EXPECT().Save(gomock.Any()).Do(func(l *client.Letter) { letter = l })
+
+	cli := client.New(client.WithHost(s.URL), client.WithDeadLetter(mockDeadLetter), client.WithRetry(2, time.Millisecond))
+	startTime := time.Now()
+	res, err := cli.Do(ctx, cli.NewRequest().Tag("team", "payments"))
+
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Len(t, body, 10000)
+
+	assert.NotEmpty(t, letter.ID)
+	assert.Equal(t, 3, letter.Attempts)
+	assert.Equal(t, 503, letter.StatusCode)
+	assert.Equal(t, []byte(strings.Repeat("a", 4096)), letter.ResponseBody)
+	assert.Empty(t, letter.Error)
+	assert.Equal(t, map[string]string{"team": "payments"}, letter.Tags)
+	assert.False(t, letter.FirstAttemptAt.Before(startTime))
+	assert.True(t, letter.LastAttemptAt.After(letter.FirstAttemptAt))
+}
+
+func TestDo_TransportErrorAfterRetries_SaveErrorToLetter(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	s.Close()
+
+	var letter *client.Letter
+	mockDeadLetter := client.NewMockDeadLetter(gomock.NewController(t))
+	mockDeadLetter.EXPECT().Save(gomock.Any()).Do(func(l *client.Letter) { letter = l })
+
+	cli := client.New(client.WithHost(s.URL), client.WithDeadLetter(mockDeadLetter), client.WithRetry(1, time.Millisecond))
+	_, err := cli.Do(ctx, cli.NewRequest())
+
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, letter.Attempts)
+	assert.Equal(t, 0, letter.StatusCode)
+	assert.Equal(t, err.Error(), letter.Error)
+}
+
+func TestDo_DeadLetterPredicate(t *testing.T) {
+	testCases := []struct {
+		scenario        string
+		givenStatusCode int
+		givenPredicate  client.DeadLetterPredicate
+		expectedSaves   int
+	}{
+		{
+			scenario:        "default predicate ignores 4XX",
+			givenStatusCode: 422,
+			expectedSaves:   0,
+		},
+		{
+			scenario:        "status code predicate saves given 4XX",
+			givenStatusCode: 422,
+			givenPredicate:  client.DeadLetterStatusCodes(409, 422),
+			expectedSaves:   1,
+		},
+		{
+			scenario:        "status code predicate keeps saving 5XX",
+			givenStatusCode: 500,
+			givenPredicate:  client.DeadLetterStatusCodes(409, 422),
+			expectedSaves:   1,
+		},
+		{
+			scenario:        "custom predicate rejects 5XX",
+			givenStatusCode: 500,
+			givenPredicate: func(request *client.Request, res *http.Response, err error) bool {
+				return false
+			},
+			expectedSaves: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				rw.WriteHeader(tc.givenStatusCode)
+			}))
+			defer s.Close()
+
+			mockDeadLetter := client.NewMockDeadLetter(gomock.NewController(t))
+			mockDeadLetter.EXPECT().Save(gomock.Any()).Times(tc.expectedSaves)
+
+			opts := []client.Option{client.WithHost(s.URL), client.WithDeadLetter(mockDeadLetter), client.WithRetry(0, time.Millisecond)}
+			if tc.givenPredicate != nil {
+				opts = append(opts, client.WithDeadLetterPredicate(tc.givenPredicate))
+			}
+			cli := client.New(opts...)
+			res, err := cli.Do(ctx, cli.NewRequest())
+
+			assert.Nil(t, err)
+			assert.Equal(t, tc.givenStatusCode, res.StatusCode)
+		})
+	}
+}
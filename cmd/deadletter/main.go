@@ -0,0 +1,525 @@
+// Command deadletter lists, inspects, exports, purges and replays the letters of a dead letter store.
+//
+// Usage:
+//
+//	deadletter <list|inspect|export|purge|replay> -path letters.jsonl [flags]
+//
+// Listing, inspecting, exporting and replaying read the store without locking or changing it, so they can be used
+// while a service writes to the store. Purging and removing replayed letters replace the store files, so they lock the
+// store and fail if it is open by a running service, which would otherwise lose its new letters
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bilginyuksel/client"
+)
+
+const (
+	_storeFile = "file"
+	_storeKV   = "kv"
+
+	_formatTable = "table"
+	_formatJSON  = "json"
+)
+
+const _usage = `usage: deadletter <command> [flags]
+
+commands:
+  list     list the matching letters
+  inspect  show every field of the matching letters
+  export   write the matching letters as json lines
+  purge    remove the matching letters from the store
+  replay   send the matching letters again
+
+list, inspect, export and replay only read the store and can be used while a
+service writes to it. purge and replay -remove rewrite the store files, stop
+the service that writes to the store before running them
+
+run "deadletter <command> -h" to see the flags of a command`
+
+// store is a dead letter store the command can read and change
+type store interface {
+	client.LetterSource
+	client.LetterRemover
+	Close() error
+}
+
+// options are the flags shared by every command
+type options struct {
+	store  string
+	path   string
+	format string
+
+	id        string
+	method    string
+	urlPrefix string
+	status    int
+	since     string
+	until     string
+	tag       string
+}
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	if err := run(ctx, os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "deadletter:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(_usage)
+	}
+
+	command, args := args[0], args[1:]
+	switch command {
+	case "list":
+		return list(args, out)
+	case "inspect":
+		return inspect(args, out)
+	case "export":
+		return export(args, out)
+	case "purge":
+		return purge(args, out)
+	case "replay":
+		return replay(ctx, args, out)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprintln(out, _usage)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q\n%s", command, _usage)
+	}
+}
+
+func list(args []string, out io.Writer) error {
+	opts := &options{}
+	if err := newFlagSet("list", opts).Parse(args); err != nil {
+		return err
+	}
+
+	letters, err := readLetters(opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.format == _formatJSON {
+		return writeJSON(out, letters)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCREATED\tMETHOD\tSTATUS\tATTEMPTS\tURL")
+	for _, letter := range letters {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\n",
+			letter.ID, letter.CreatedAt.Format(time.RFC3339), letter.Method, letter.StatusCode, letter.Attempts, letter.URL)
+	}
+	return w.Flush()
+}
+
+func inspect(args []string, out io.Writer) error {
+	opts := &options{}
+	flags := newFlagSet("inspect", opts)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if opts.id == "" && flags.NArg() > 0 {
+		opts.id = flags.Arg(0)
+	}
+
+	letters, err := readLetters(opts)
+	if err != nil {
+		return err
+	}
+	if len(letters) == 0 {
+		return client.ErrLetterNotFound
+	}
+
+	if opts.format == _formatJSON {
+		return writeJSON(out, letters)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for i, letter := range letters {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "ID\t%s\n", letter.ID)
+		fmt.Fprintf(w, "Created\t%s\n", letter.CreatedAt.Format(time.RFC3339Nano))
+		fmt.Fprintf(w, "Request\t%s %s\n", letter.Method, letter.URL)
+		fmt.Fprintf(w, "Attempts\t%d (%s - %s)\n", letter.Attempts,
+			letter.FirstAttemptAt.Format(time.RFC3339Nano), letter.LastAttemptAt.Format(time.RFC3339Nano))
+		fmt.Fprintf(w, "Status\t%d\n", letter.StatusCode)
+		if letter.Error != "" {
+			fmt.Fprintf(w, "Error\t%s\n", letter.Error)
+		}
+		for key, value := range letter.Tags {
+			fmt.Fprintf(w, "Tag\t%s=%s\n", key, value)
+		}
+		for name, values := range letter.Headers {
+			fmt.Fprintf(w, "Header\t%s: %s\n", name, strings.Join(values, ", "))
+		}
+		if letter.Encryption != nil {
+			fmt.Fprintf(w, "Body\t<encrypted with %s>\n", letter.Encryption.Algorithm)
+		} else if letter.BodyTruncated {
+			fmt.Fprintf(w, "Body\t%s... (truncated)\n", letter.Body)
+		} else {
+			fmt.Fprintf(w, "Body\t%s\n", letter.Body)
+		}
+		fmt.Fprintf(w, "Response\t%s\n", letter.ResponseBody)
+	}
+	return w.Flush()
+}
+
+func export(args []string, out io.Writer) error {
+	opts := &options{}
+	flags := newFlagSet("export", opts)
+	outPath := flags.String("out", "", "file to write the letters, the standard output is used if it is empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	letters, err := readLetters(opts)
+	if err != nil {
+		return err
+	}
+
+	if *outPath == "" {
+		return writeLetters(out, letters)
+	}
+
+	file, err := os.Create(*outPath)
+	if err != nil {
+		return err
+	}
+	if err := writeLetters(file, letters); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// writeLetters writes the letters as json lines, so an export can be read by client.NewLetterReader
+func writeLetters(out io.Writer, letters []*client.Letter) error {
+	encoder := json.NewEncoder(out)
+	for _, letter := range letters {
+		if err := encoder.Encode(letter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func purge(args []string, out io.Writer) error {
+	opts := &options{}
+	flags := newFlagSet("purge", opts)
+	all := flags.Bool("all", false, "allow purging without any filter")
+	dryRun := flags.Bool("dry-run", false, "only report the letters that would be removed")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if !*all && !opts.hasFilter() {
+		return errors.New("purge needs a filter, use -all to remove every letter")
+	}
+
+	s, err := openStore(opts)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	letters, err := collect(s, opts)
+	if err != nil {
+		return err
+	}
+
+	if !*dryRun {
+		if err := s.Remove(letters...); err != nil {
+			return err
+		}
+	}
+
+	if opts.format == _formatJSON {
+		return writeJSON(out, map[string]interface{}{"removed": len(letters), "dryRun": *dryRun})
+	}
+	if *dryRun {
+		fmt.Fprintf(out, "%d letters would be removed\n", len(letters))
+		return nil
+	}
+	fmt.Fprintf(out, "%d letters removed\n", len(letters))
+	return nil
+}
+
+// replayResult is the json output of a replayed letter
+type replayResult struct {
+	ID         string `json:"id"`
+	Method     string `json:"method"`
+	URL        string `json:"url"`
+	StatusCode int    `json:"statusCode,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DryRun     bool   `json:"dryRun,omitempty"`
+	Removed    bool   `json:"removed,omitempty"`
+}
+
+func replay(ctx context.Context, args []string, out io.Writer) error {
+	opts := &options{}
+	flags := newFlagSet("replay", opts)
+	host := flags.String("host", "", "send the letters to this host instead of their own, such as http://localhost:8080")
+	dryRun := flags.Bool("dry-run", false, "only report the letters that would be replayed")
+	remove := flags.Bool("remove", false, "remove the successfully replayed letters from the store")
+	retry := flags.Int("retry", 0, "number of retries of every replayed letter")
+	timeout := flags.Duration("timeout", 30*time.Second, "timeout of every replayed request")
+	keyFile := flags.String("key-file", "", "file with the hex encoded key that decrypts encrypted letters")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var source client.LetterSource
+	if *remove {
+		s, err := openStore(opts)
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+		source = s
+	} else {
+		s, err := openSource(opts)
+		if err != nil {
+			return err
+		}
+		source = s
+	}
+
+	replayOpts := []client.ReplayOption{client.WithReplayFilter(opts.matches)}
+	if *host != "" {
+		replayOpts = append(replayOpts, client.WithReplayHost(*host))
+	}
+	if *dryRun {
+		replayOpts = append(replayOpts, client.WithReplayDryRun())
+	}
+	if *remove {
+		replayOpts = append(replayOpts, client.WithReplayRemoveSucceeded())
+	}
+	if *keyFile != "" {
+		key, err := readKey(*keyFile)
+		if err != nil {
+			return err
+		}
+		replayOpts = append(replayOpts, client.WithReplayDecryption(key))
+	}
+
+	cli := client.New(client.WithRetry(*retry, time.Second), client.WithHTTPClient(&http.Client{Timeout: *timeout}))
+	results, replayErr := client.NewReplayer(cli, source, replayOpts...).Replay(ctx)
+
+	outputs := make([]replayResult, 0, len(results))
+	for _, result := range results {
+		output := replayResult{
+			ID:         result.Letter.ID,
+			Method:     result.Letter.Method,
+			URL:        result.Letter.URL,
+			StatusCode: result.StatusCode,
+			DryRun:     result.DryRun,
+			Removed:    result.Removed,
+		}
+		if result.Err != nil {
+			output.Error = result.Err.Error()
+		}
+		outputs = append(outputs, output)
+	}
+
+	if err := writeReplayResults(out, opts.format, outputs); err != nil {
+		return err
+	}
+	return replayErr
+}
+
+func writeReplayResults(out io.Writer, format string, results []replayResult) error {
+	if format == _formatJSON {
+		return writeJSON(out, results)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tMETHOD\tURL\tSTATUS\tRESULT")
+	for _, result := range results {
+		outcome := "failed"
+		switch {
+		case result.DryRun:
+			outcome = "dry run"
+		case result.Error != "":
+			outcome = result.Error
+		case result.Removed:
+			outcome = "replayed and removed"
+		case result.StatusCode >= 200 && result.StatusCode <= 299:
+			outcome = "replayed"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", result.ID, result.Method, result.URL, result.StatusCode, outcome)
+	}
+	return w.Flush()
+}
+
+func newFlagSet(name string, opts *options) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.StringVar(&opts.store, "store", _storeFile, "type of the store, file or kv")
+	flags.StringVar(&opts.path, "path", "", "path of the store")
+	flags.StringVar(&opts.format, "format", _formatTable, "output format, table or json")
+
+	flags.StringVar(&opts.id, "id", "", "only the letter with this id")
+	flags.StringVar(&opts.method, "method", "", "only the letters with this http method")
+	flags.StringVar(&opts.urlPrefix, "url-prefix", "", "only the letters whose url starts with this prefix")
+	flags.IntVar(&opts.status, "status", 0, "only the letters with this status code")
+	flags.StringVar(&opts.since, "since", "", "only the letters created at or after this RFC3339 time")
+	flags.StringVar(&opts.until, "until", "", "only the letters created before this RFC3339 time")
+	flags.StringVar(&opts.tag, "tag", "", "only the letters with this key=value tag")
+	return flags
+}
+
+func (o *options) hasFilter() bool {
+	return o.id != "" || o.method != "" || o.urlPrefix != "" || o.status != 0 || o.since != "" || o.until != "" || o.tag != ""
+}
+
+// matches reports whether the letter passes every given filter, the time filters are validated by validate
+func (o *options) matches(letter *client.Letter) bool {
+	if o.id != "" && letter.ID != o.id {
+		return false
+	}
+	if o.method != "" && !strings.EqualFold(letter.Method, o.method) {
+		return false
+	}
+	if o.urlPrefix != "" && !strings.HasPrefix(letter.URL, o.urlPrefix) {
+		return false
+	}
+	if o.status != 0 && letter.StatusCode != o.status {
+		return false
+	}
+	if since, _ := parseTime(o.since); !since.IsZero() && letter.CreatedAt.Before(since) {
+		return false
+	}
+	if until, _ := parseTime(o.until); !until.IsZero() && !letter.CreatedAt.Before(until) {
+		return false
+	}
+	if o.tag != "" {
+		key, value, _ := cut(o.tag, "=")
+		if tagValue, ok := letter.Tags[key]; !ok || tagValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+// validate checks the shared flags and that the store exists
+func validate(opts *options) error {
+	if opts.path == "" {
+		return errors.New("-path is required")
+	}
+	if opts.format != _formatTable && opts.format != _formatJSON {
+		return fmt.Errorf("unknown format %q", opts.format)
+	}
+	if opts.store != _storeFile && opts.store != _storeKV {
+		return fmt.Errorf("unknown store %q", opts.store)
+	}
+	if _, err := parseTime(opts.since); err != nil {
+		return fmt.Errorf("invalid -since: %v", err)
+	}
+	if _, err := parseTime(opts.until); err != nil {
+		return fmt.Errorf("invalid -until: %v", err)
+	}
+	// opening a store creates it, a mistyped path should not leave an empty store behind
+	_, err := os.Stat(opts.path)
+	return err
+}
+
+// openSource opens the store read only, it neither locks nor changes the store
+func openSource(opts *options) (client.LetterSource, error) {
+	if err := validate(opts); err != nil {
+		return nil, err
+	}
+	if opts.store == _storeKV {
+		return client.NewKVLetterSource(opts.path), nil
+	}
+	return client.NewFileLetterSource(opts.path), nil
+}
+
+// openStore opens the store to change it, the store is locked until it is closed
+func openStore(opts *options) (store, error) {
+	if err := validate(opts); err != nil {
+		return nil, err
+	}
+
+	var (
+		s   store
+		err error
+	)
+	switch opts.store {
+	case _storeFile:
+		s, err = client.NewFileDeadLetter(opts.path)
+	case _storeKV:
+		s, err = client.NewKVDeadLetter(opts.path)
+	default:
+		return nil, fmt.Errorf("unknown store %q", opts.store)
+	}
+	if errors.Is(err, client.ErrStoreLocked) {
+		return nil, fmt.Errorf("%s: %w, stop the service that writes to it first", opts.path, err)
+	}
+	return s, err
+}
+
+func readLetters(opts *options) ([]*client.Letter, error) {
+	source, err := openSource(opts)
+	if err != nil {
+		return nil, err
+	}
+	return collect(source, opts)
+}
+
+func collect(s client.LetterSource, opts *options) ([]*client.Letter, error) {
+	var letters []*client.Letter
+	err := s.Walk(func(letter *client.Letter) error {
+		if opts.matches(letter) {
+			letters = append(letters, letter)
+		}
+		return nil
+	})
+	return letters, err
+}
+
+func readKey(path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(strings.TrimSpace(string(content)))
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func writeJSON(out io.Writer, value interface{}) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bilginyuksel/client"
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+func newKVStore(t *testing.T, letters ...*client.Letter) string {
+	path := filepath.Join(t.TempDir(), "letters.kv")
+	deadLetter, err := client.NewKVDeadLetter(path)
+	assert.Nil(t, err)
+	assert.Nil(t, deadLetter.SaveLetters(ctx, letters...))
+	assert.Nil(t, deadLetter.Close())
+	return path
+}
+
+func collectFileLetters(t *testing.T, deadLetter *client.FileDeadLetter) []*client.Letter {
+	var letters []*client.Letter
+	assert.Nil(t, deadLetter.Walk(func(letter *client.Letter) error {
+		letters = append(letters, letter)
+		return nil
+	}))
+	return letters
+}
+
+func TestRun_ListJSON_PrintMatchingLetters(t *testing.T) {
+	path := newKVStore(t,
+		&client.Letter{ID: "1", Method: http.MethodPost, URL: "http://api/orders", StatusCode: 500},
+		&client.Letter{ID: "2", Method: http.MethodGet, URL: "http://api/payments", StatusCode: 422},
+	)
+
+	var out bytes.Buffer
+	err := run(ctx, []string{"list", "-store", "kv", "-path", path, "-format", "json", "-status", "422"}, &out)
+
+	var letters []*client.Letter
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &letters))
+	assert.Len(t, letters, 1)
+	assert.Equal(t, "2", letters[0].ID)
+}
+
+func TestRun_Purge(t *testing.T) {
+	path := newKVStore(t,
+		&client.Letter{ID: "1", Method: http.MethodPost, URL: "http://api/orders"},
+		&client.Letter{ID: "2", Method: http.MethodGet, URL: "http://api/payments"},
+	)
+
+	var out bytes.Buffer
+	assert.NotNil(t, run(ctx, []string{"purge", "-store", "kv", "-path", path}, &out))
+	assert.Nil(t, run(ctx, []string{"purge", "-store", "kv", "-path", path, "-url-prefix", "http://api/orders"}, &out))
+	assert.Equal(t, "1 letters removed\n", out.String())
+
+	deadLetter, err := client.NewKVDeadLetter(path)
+	assert.Nil(t, err)
+	defer deadLetter.Close()
+	letters := deadLetter.List()
+	assert.Len(t, letters, 1)
+	assert.Equal(t, "2", letters[0].ID)
+}
+
+func TestRun_ReplayWithHost_SendToGivenHostAndRemoveSucceeded(t *testing.T) {
+	var count int32
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		assert.Equal(t, "/orders", r.URL.Path)
+	}))
+	defer s.Close()
+
+	path := newKVStore(t, &client.Letter{ID: "1", Method: http.MethodPost, URL: "http://unreachable.invalid/orders", Body: []byte("{}")})
+
+	var out bytes.Buffer
+	err := run(ctx, []string{"replay", "-store", "kv", "-path", path, "-host", s.URL, "-remove", "-format", "json"}, &out)
+
+	var results []replayResult
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &results))
+	assert.Equal(t, []replayResult{{ID: "1", Method: http.MethodPost, URL: "http://unreachable.invalid/orders", StatusCode: 200, Removed: true}}, results)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+}
+
+func TestRun_MissingStore_ReturnErr(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.jsonl")
+
+	err := run(ctx, []string{"list", "-path", path}, &bytes.Buffer{})
+
+	assert.NotNil(t, err)
+	assert.NoFileExists(t, path)
+}
+
+func TestRun_StoreOpenByService_ReturnStoreLockedErr(t *testing.T) {
+	path := newKVStore(t, &client.Letter{ID: "1"})
+	deadLetter, err := client.NewKVDeadLetter(path)
+	assert.Nil(t, err)
+	defer deadLetter.Close()
+
+	err = run(ctx, []string{"purge", "-store", "kv", "-path", path, "-all"}, &bytes.Buffer{})
+
+	assert.ErrorIs(t, err, client.ErrStoreLocked)
+	assert.Len(t, deadLetter.List(), 1)
+}
+
+func TestRun_ListStoreOpenByService_ReadWithoutLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "letters.jsonl")
+	deadLetter, err := client.NewFileDeadLetter(path)
+	assert.Nil(t, err)
+	defer deadLetter.Close()
+	assert.Nil(t, deadLetter.Save(&client.Letter{ID: "1", Method: http.MethodGet, URL: "http://api/orders"}))
+
+	var out bytes.Buffer
+	err = run(ctx, []string{"list", "-path", path, "-format", "json"}, &out)
+
+	var letters []*client.Letter
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &letters))
+	assert.Len(t, letters, 1)
+
+	assert.Nil(t, run(ctx, []string{"export", "-path", path}, &bytes.Buffer{}))
+	assert.Nil(t, run(ctx, []string{"replay", "-path", path, "-dry-run"}, &bytes.Buffer{}))
+	assert.ErrorIs(t, run(ctx, []string{"replay", "-path", path, "-remove"}, &bytes.Buffer{}), client.ErrStoreLocked)
+
+	assert.Nil(t, deadLetter.Save(&client.Letter{ID: "2", Method: http.MethodGet, URL: "http://api/payments"}))
+	assert.Len(t, collectFileLetters(t, deadLetter), 2)
+}
@@ -0,0 +1,205 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	urlpkg "net/url"
+)
+
+// ErrNoDeadLetterRoute is returned by a routing deadletter when no route matches a letter and there is no default sink
+var ErrNoDeadLetterRoute = errors.New("no deadletter route matches the letter")
+
+// FanOutMode decides when a fan out deadletter reports success
+type FanOutMode int
+
+const (
+	// FanOutAll succeeds only when every sink saves the letters
+	FanOutAll FanOutMode = iota
+	// FanOutAny succeeds when at least one sink saves the letters
+	FanOutAny
+)
+
+// FanOutDeadLetter saves the letters to every sink at the same time
+type FanOutDeadLetter struct {
+	mode  FanOutMode
+	sinks []DeadLetterV2
+}
+
+// NewFanOutDeadLetter create a deadletter that writes the letters to every given sink
+func NewFanOutDeadLetter(mode FanOutMode, sinks ...DeadLetterV2) *FanOutDeadLetter {
+	return &FanOutDeadLetter{mode: mode, sinks: sinks}
+}
+
+// Save saves the letter to every sink
+func (d *FanOutDeadLetter) Save(letter *Letter) error {
+	return d.SaveLetters(context.Background(), letter)
+}
+
+// SaveLetters saves the letters to every sink and waits for all of them
+func (d *FanOutDeadLetter) SaveLetters(ctx context.Context, letters ...*Letter) error {
+	errs := make([]error, len(d.sinks))
+
+	var wg sync.WaitGroup
+	for i, sink := range d.sinks {
+		wg.Add(1)
+		go func(i int, sink DeadLetterV2) {
+			defer wg.Done()
+			errs[i] = sink.SaveLetters(ctx, letters...)
+		}(i, sink)
+	}
+	wg.Wait()
+
+	var (
+		failed   int
+		firstErr error
+	)
+	for _, err := range errs {
+		if err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	if failed == 0 || (d.mode == FanOutAny && failed < len(d.sinks)) {
+		return nil
+	}
+	return fmt.Errorf("%d of %d deadletters failed: %w", failed, len(d.sinks), firstErr)
+}
+
+// DeadLetterRoute sends the letters it matches to its sink
+type DeadLetterRoute struct {
+	Match func(letter *Letter) bool
+	Sink  DeadLetterV2
+}
+
+// RouteByHost create a route for the letters that are sent to the given host, such as "api.example.com:8080"
+func RouteByHost(host string, sink DeadLetterV2) DeadLetterRoute {
+	return DeadLetterRoute{
+		Match: func(letter *Letter) bool {
+			url, err := urlpkg.Parse(letter.URL)
+			return err == nil && strings.EqualFold(url.Host, host)
+		},
+		Sink: sink,
+	}
+}
+
+// RouteByPathPrefix create a route for the letters whose url path starts with the given prefix
+func RouteByPathPrefix(prefix string, sink DeadLetterV2) DeadLetterRoute {
+	return DeadLetterRoute{
+		Match: func(letter *Letter) bool {
+			url, err := urlpkg.Parse(letter.URL)
+			return err == nil && strings.HasPrefix(url.Path, prefix)
+		},
+		Sink: sink,
+	}
+}
+
+// RouteByStatusCode create a route for the letters whose last response has one of the given status codes
+func RouteByStatusCode(sink DeadLetterV2, statusCodes ...int) DeadLetterRoute {
+	return DeadLetterRoute{
+		Match: func(letter *Letter) bool {
+			for _, statusCode := range statusCodes {
+				if letter.StatusCode == statusCode {
+					return true
+				}
+			}
+			return false
+		},
+		Sink: sink,
+	}
+}
+
+// RoutingDeadLetter saves every letter to the sink of the first route that matches it.
+// Letters that no route matches are saved to the default sink
+type RoutingDeadLetter struct {
+	routes      []DeadLetterRoute
+	defaultSink DeadLetterV2
+}
+
+// NewRoutingDeadLetter create a deadletter that routes the letters with the given routes in order.
+// The default sink can be nil, then the letters that no route matches are rejected with ErrNoDeadLetterRoute
+func NewRoutingDeadLetter(defaultSink DeadLetterV2, routes ...DeadLetterRoute) *RoutingDeadLetter {
+	return &RoutingDeadLetter{routes: routes, defaultSink: defaultSink}
+}
+
+// Save saves the letter to the sink of its route
+func (d *RoutingDeadLetter) Save(letter *Letter) error {
+	return d.SaveLetters(context.Background(), letter)
+}
+
+// SaveLetters groups the letters by their sinks and saves every group as a single batch
+func (d *RoutingDeadLetter) SaveLetters(ctx context.Context, letters ...*Letter) error {
+	// letters are grouped by the index of their route, the default sink has the index of len(routes)
+	var (
+		order  []int
+		groups = make(map[int][]*Letter)
+	)
+	for _, letter := range letters {
+		index := d.route(letter)
+		if d.sink(index) == nil {
+			return ErrNoDeadLetterRoute
+		}
+		if _, ok := groups[index]; !ok {
+			order = append(order, index)
+		}
+		groups[index] = append(groups[index], letter)
+	}
+
+	for _, index := range order {
+		if err := d.sink(index).SaveLetters(ctx, groups[index]...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *RoutingDeadLetter) route(letter *Letter) int {
+	for i, route := range d.routes {
+		if route.Match(letter) {
+			return i
+		}
+	}
+	return len(d.routes)
+}
+
+func (d *RoutingDeadLetter) sink(index int) DeadLetterV2 {
+	if index < len(d.routes) {
+		return d.routes[index].Sink
+	}
+	return d.defaultSink
+}
+
+// FallbackDeadLetter tries the sinks in order until one of them saves the letters
+type FallbackDeadLetter struct {
+	sinks []DeadLetterV2
+}
+
+// NewFallbackDeadLetter create a deadletter that tries the given sinks in order
+func NewFallbackDeadLetter(sinks ...DeadLetterV2) *FallbackDeadLetter {
+	return &FallbackDeadLetter{sinks: sinks}
+}
+
+// Save saves the letter to the first sink that accepts it
+func (d *FallbackDeadLetter) Save(letter *Letter) error {
+	return d.SaveLetters(context.Background(), letter)
+}
+
+// SaveLetters saves the letters to the first sink that accepts them, the error of the last sink is returned if none does
+func (d *FallbackDeadLetter) SaveLetters(ctx context.Context, letters ...*Letter) error {
+	err := errors.New("there is no deadletter to fall back")
+	for _, sink := range d.sinks {
+		if err = sink.SaveLetters(ctx, letters...); err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,113 @@
+package client_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bilginyuksel/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFanOutDeadLetter_SaveLetters(t *testing.T) {
+	testCases := []struct {
+		scenario    string
+		givenMode   client.FanOutMode
+		givenErrs   []error
+		expectedErr bool
+	}{
+		{scenario: "all succeed", givenMode: client.FanOutAll, givenErrs: []error{nil, nil}},
+		{scenario: "all mode with a failure", givenMode: client.FanOutAll, givenErrs: []error{nil, errors.New("failed")}, expectedErr: true},
+		{scenario: "any mode with a failure", givenMode: client.FanOutAny, givenErrs: []error{nil, errors.New("failed")}},
+		{scenario: "any mode with only failures", givenMode: client.FanOutAny, givenErrs: []error{errors.New("failed"), errors.New("failed")}, expectedErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			var sinks []client.DeadLetterV2
+			var recorders []*recordingDeadLetter
+			for _, err := range tc.givenErrs {
+				recorder := &recordingDeadLetter{err: err}
+				recorders = append(recorders, recorder)
+				sinks = append(sinks, recorder)
+			}
+
+			err := client.NewFanOutDeadLetter(tc.givenMode, sinks...).SaveLetters(ctx, &client.Letter{}, &client.Letter{})
+
+			assert.Equal(t, tc.expectedErr, err != nil)
+			for _, recorder := range recorders {
+				assert.Equal(t, []int{2}, recorder.batchSizes())
+			}
+		})
+	}
+}
+
+func TestRoutingDeadLetter_SaveLetters_SaveEveryLetterToItsRoute(t *testing.T) {
+	payments, analytics, byStatus, fallback := &recordingDeadLetter{}, &recordingDeadLetter{}, &recordingDeadLetter{}, &recordingDeadLetter{}
+	deadLetter := client.NewRoutingDeadLetter(fallback,
+		client.RouteByPathPrefix("/payments", payments),
+		client.RouteByHost("analytics.example.com", analytics),
+		client.RouteByStatusCode(byStatus, 409, 422),
+	)
+
+	err := deadLetter.SaveLetters(ctx,
+		&client.Letter{URL: "https://api.example.com/payments/1"},
+		&client.Letter{URL: "https://analytics.example.com/events"},
+		&client.Letter{URL: "https://api.example.com/payments/2"},
+		&client.Letter{URL: "https://api.example.com/orders", StatusCode: 422},
+		&client.Letter{URL: "https://api.example.com/orders", StatusCode: 500},
+	)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []int{2}, payments.batchSizes())
+	assert.Equal(t, []int{1}, analytics.batchSizes())
+	assert.Equal(t, []int{1}, byStatus.batchSizes())
+	assert.Equal(t, []int{1}, fallback.batchSizes())
+}
+
+func TestRoutingDeadLetter_NoMatchingRouteWithoutDefault_ReturnErr(t *testing.T) {
+	payments := &recordingDeadLetter{}
+	deadLetter := client.NewRoutingDeadLetter(nil, client.RouteByPathPrefix("/payments", payments))
+
+	err := deadLetter.Save(&client.Letter{URL: "https://api.example.com/orders"})
+
+	assert.ErrorIs(t, err, client.ErrNoDeadLetterRoute)
+	assert.Empty(t, payments.batchSizes())
+}
+
+func TestFallbackDeadLetter_SaveLetters_StopAtFirstSuccessfulSink(t *testing.T) {
+	first, second, third := &recordingDeadLetter{err: errors.New("failed")}, &recordingDeadLetter{}, &recordingDeadLetter{}
+
+	err := client.NewFallbackDeadLetter(first, second, third).SaveLetters(ctx, &client.Letter{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1}, first.batchSizes())
+	assert.Equal(t, []int{1}, second.batchSizes())
+	assert.Empty(t, third.batchSizes())
+}
+
+func TestFallbackDeadLetter_EverySinkFails_ReturnLastErr(t *testing.T) {
+	lastErr := errors.New("last")
+
+	err := client.NewFallbackDeadLetter(&recordingDeadLetter{err: errors.New("first")}, &recordingDeadLetter{err: lastErr}).SaveLetters(ctx, &client.Letter{})
+
+	assert.Equal(t, lastErr, err)
+}
+
+func TestDo_RoutingDeadLetter_SaveRequestToRoutedSink(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(500)
+	}))
+
+	payments, other := &recordingDeadLetter{}, &recordingDeadLetter{}
+	cli := client.New(client.WithHost(s.URL), client.WithRetry(0, time.Millisecond),
+		client.WithDeadLetterV2(client.NewRoutingDeadLetter(other, client.RouteByPathPrefix("/payments", payments))))
+
+	_, _ = cli.Do(ctx, cli.NewRequest().Path("/payments/1"))
+	_, _ = cli.Do(ctx, cli.NewRequest().Path("/analytics"))
+
+	assert.Equal(t, []int{1}, payments.batchSizes())
+	assert.Equal(t, []int{1}, other.batchSizes())
+}
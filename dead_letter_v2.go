@@ -0,0 +1,58 @@
+package client
+
+import (
+	"context"
+	"time"
+)
+
+// DeadLetterV2 save requests to somewhere to ensure consistency.
+// Unlike DeadLetter it takes a context so a slow sink can be cancelled, and it accepts letters in batches
+type DeadLetterV2 interface {
+	SaveLetters(ctx context.Context, letters ...*Letter) error
+}
+
+// AdaptDeadLetter wraps a DeadLetter so it can be used as a DeadLetterV2.
+// Letters are saved one by one and saving stops when the context is done
+func AdaptDeadLetter(deadLetter DeadLetter) DeadLetterV2 {
+	if deadLetter == nil {
+		return nil
+	}
+	if deadLetterV2, ok := deadLetter.(DeadLetterV2); ok {
+		return deadLetterV2
+	}
+	return &deadLetterAdapter{deadLetter: deadLetter}
+}
+
+type deadLetterAdapter struct {
+	deadLetter DeadLetter
+}
+
+func (a *deadLetterAdapter) SaveLetters(ctx context.Context, letters ...*Letter) error {
+	for _, letter := range letters {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := a.deadLetter.Save(letter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// detachedContext keeps the values of its parent but is never cancelled.
+// Requests that are given up because their context is done are still saved with it
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
@@ -2,7 +2,7 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -31,6 +31,7 @@ type Coffee struct {
 func main() {
 	c := NewMockClient(client.WithHost("http://localhost:8080"),
 		client.WithRetry(3, time.Millisecond*200),
+		client.WithErrorType(func() error { return &ErrorMessage{} }),
 	)
 	// req := c.NewRequest(context.Background()).Path("/coffee/hot")
 
@@ -55,18 +56,21 @@ func main() {
 		Ingredients: []string{"Coffee", "Milk", "Sugar"},
 	}
 
-	coffeeBytes, _ := json.Marshal(coffee)
-
 	ctx := context.Background()
 	req := c.NewRequest().
 		Path("/api").
 		Method(http.MethodPost).
-		Body(coffeeBytes).
-		AddHeader("Content-Type", "application/json").
+		JSONBody(coffee).
 		AddHeader("Accept", "application/json")
 
-	var response ErrorMessage
+	var response Coffee
 	err := c.PostJSON(ctx, req, &response)
+
+	var errorMessage *ErrorMessage
+	if errors.As(err, &errorMessage) {
+		fmt.Println(errorMessage.Code, errorMessage.Message)
+		return
+	}
 	if err != nil {
 		panic(err)
 	}
@@ -96,3 +100,7 @@ type ErrorMessage struct {
 	Message string `json:"message"`
 	Code    int    `json:"code"`
 }
+
+func (e *ErrorMessage) Error() string {
+	return fmt.Sprintf("%d: %s", e.Code, e.Message)
+}
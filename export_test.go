@@ -0,0 +1,15 @@
+package client
+
+import "os"
+
+// FailKVWritesAfter makes the next write of the store write only n bytes and return the given error
+func FailKVWritesAfter(d *KVDeadLetter, n int, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.writeFile = func(file *os.File, b []byte) (int, error) {
+		d.writeFile = (*os.File).Write
+		written, _ := file.Write(b[:n])
+		return written, err
+	}
+}
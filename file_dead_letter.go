@@ -0,0 +1,493 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const _rotatedFileTimeFormat = "20060102T150405.000000000"
+
+// FileSyncMode decides when the letters written to the file are flushed to the disk
+type FileSyncMode int
+
+const (
+	// FileSyncNever leaves flushing to the operating system
+	FileSyncNever FileSyncMode = iota
+	// FileSyncAlways flushes the file after every letter
+	FileSyncAlways
+	// FileSyncInterval flushes the file when the sync interval passed since the last flush
+	FileSyncInterval
+)
+
+// FileDeadLetter is a deadletter that appends every letter to a file as a json line.
+// It is safe to use from many goroutines. When the file reaches the max size or the max age
+// it is renamed with a timestamp suffix and a new file is started
+type FileDeadLetter struct {
+	mu           sync.Mutex
+	path         string
+	file         *os.File
+	lock         *os.File
+	size         int64
+	openedAt     time.Time
+	lastSyncedAt time.Time
+
+	syncMode     FileSyncMode
+	syncInterval time.Duration
+	maxSize      int64
+	maxAge       time.Duration
+}
+
+// FileDeadLetterOption is a function that configures a file deadletter
+type FileDeadLetterOption func(d *FileDeadLetter)
+
+// WithFileSync create file deadletter option function with the sync mode
+func WithFileSync(mode FileSyncMode) FileDeadLetterOption {
+	return func(d *FileDeadLetter) {
+		d.syncMode = mode
+	}
+}
+
+// WithFileSyncInterval create file deadletter option function that flushes the file at most once in the given interval
+func WithFileSyncInterval(interval time.Duration) FileDeadLetterOption {
+	return func(d *FileDeadLetter) {
+		d.syncMode = FileSyncInterval
+		d.syncInterval = interval
+	}
+}
+
+// WithFileMaxSize create file deadletter option function that rotates the file when it would exceed the given bytes
+func WithFileMaxSize(maxSize int64) FileDeadLetterOption {
+	return func(d *FileDeadLetter) {
+		d.maxSize = maxSize
+	}
+}
+
+// WithFileMaxAge create file deadletter option function that rotates the file when it is older than the given age
+func WithFileMaxAge(maxAge time.Duration) FileDeadLetterOption {
+	return func(d *FileDeadLetter) {
+		d.maxAge = maxAge
+	}
+}
+
+// NewFileDeadLetter create a file deadletter that appends letters to the file in the given path.
+// The store is locked until it is closed, opening it again returns ErrStoreLocked
+func NewFileDeadLetter(path string, opts ...FileDeadLetterOption) (*FileDeadLetter, error) {
+	d := &FileDeadLetter{path: path}
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	lock, err := lockStore(path)
+	if err != nil {
+		return nil, err
+	}
+	d.lock = lock
+
+	if err := d.open(); err != nil {
+		lock.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// Save append the letter to the file as a single json line
+func (d *FileDeadLetter) Save(letter *Letter) error {
+	line, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.file == nil {
+		return os.ErrClosed
+	}
+
+	if d.shouldRotate(int64(len(line))) {
+		if err := d.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := d.file.Write(line)
+	d.size += int64(n)
+	if err != nil {
+		return err
+	}
+
+	return d.sync()
+}
+
+// SaveLetters append the letters to the file one by one until the context is done
+func (d *FileDeadLetter) SaveLetters(ctx context.Context, letters ...*Letter) error {
+	for _, letter := range letters {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := d.Save(letter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Walk calls the given function for every stored letter, from the oldest rotated file to the current file.
+// Walking stops at the first error
+func (d *FileDeadLetter) Walk(fn func(letter *Letter) error) error {
+	paths, err := d.files()
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		if err := walkFile(path, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close flush and close the file
+func (d *FileDeadLetter) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.file == nil {
+		return nil
+	}
+
+	syncErr := d.file.Sync()
+	closeErr := d.file.Close()
+	d.file = nil
+	d.lock.Close()
+	if syncErr != nil {
+		return syncErr
+	}
+	return closeErr
+}
+
+func (d *FileDeadLetter) open() error {
+	file, err := os.OpenFile(d.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	d.file = file
+	d.size = info.Size()
+	d.openedAt = time.Now()
+	d.lastSyncedAt = d.openedAt
+	return nil
+}
+
+func (d *FileDeadLetter) shouldRotate(lineSize int64) bool {
+	if d.size == 0 {
+		return false
+	}
+	if d.maxSize > 0 && d.size+lineSize > d.maxSize {
+		return true
+	}
+	return d.maxAge > 0 && time.Since(d.openedAt) >= d.maxAge
+}
+
+// rotate renames the current file with a timestamp suffix and opens a new one, the caller must hold the lock
+func (d *FileDeadLetter) rotate() error {
+	if err := d.file.Sync(); err != nil {
+		return err
+	}
+	if err := d.file.Close(); err != nil {
+		return err
+	}
+	d.file = nil
+
+	rotatedPath := fmt.Sprintf("%s.%s", d.path, time.Now().UTC().Format(_rotatedFileTimeFormat))
+	for i := 1; fileExists(rotatedPath); i++ {
+		rotatedPath = fmt.Sprintf("%s.%s-%d", d.path, time.Now().UTC().Format(_rotatedFileTimeFormat), i)
+	}
+	if err := os.Rename(d.path, rotatedPath); err != nil {
+		return err
+	}
+
+	return d.open()
+}
+
+// sync flushes the file according to the sync mode, the caller must hold the lock
+func (d *FileDeadLetter) sync() error {
+	switch d.syncMode {
+	case FileSyncAlways:
+		return d.file.Sync()
+	case FileSyncInterval:
+		if time.Since(d.lastSyncedAt) < d.syncInterval {
+			return nil
+		}
+		d.lastSyncedAt = time.Now()
+		return d.file.Sync()
+	default:
+		return nil
+	}
+}
+
+// Remove deletes the given letters from the stored files.
+// Every given letter removes a single stored letter that is equal to it
+func (d *FileDeadLetter) Remove(letters ...*Letter) error {
+	remaining := make(map[string]int, len(letters))
+	for _, letter := range letters {
+		key, err := letterKey(letter)
+		if err != nil {
+			return err
+		}
+		remaining[key]++
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.file == nil {
+		return os.ErrClosed
+	}
+
+	paths, err := d.filesLocked()
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths[:len(paths)-1] {
+		if err := rewriteFile(path, remaining); err != nil {
+			return err
+		}
+		if info, err := os.Stat(path); err == nil && info.Size() == 0 {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+	}
+
+	// the current file is reopened after rewriting because it is replaced by a new file
+	if err := d.file.Close(); err != nil {
+		return err
+	}
+	d.file = nil
+	rewriteErr := rewriteFile(d.path, remaining)
+	if err := d.open(); err != nil {
+		return err
+	}
+	return rewriteErr
+}
+
+// files returns the rotated files from the oldest to the newest followed by the current file
+func (d *FileDeadLetter) files() ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.filesLocked()
+}
+
+func (d *FileDeadLetter) filesLocked() ([]string, error) {
+	return storeFiles(d.path)
+}
+
+// storeFiles returns the rotated files of the store in the given path from the oldest to the newest followed by the path
+func storeFiles(path string) ([]string, error) {
+	candidates, err := filepath.Glob(escapeGlob(path) + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	// other files next to the store, such as a backup, are never read or changed
+	type rotatedFile struct {
+		path      string
+		rotatedAt time.Time
+		n         int
+	}
+	var rotated []rotatedFile
+	for _, candidate := range candidates {
+		if rotatedAt, n, ok := parseRotatedSuffix(strings.TrimPrefix(candidate, path+".")); ok {
+			rotated = append(rotated, rotatedFile{path: candidate, rotatedAt: rotatedAt, n: n})
+		}
+	}
+	sort.Slice(rotated, func(i, j int) bool {
+		if !rotated[i].rotatedAt.Equal(rotated[j].rotatedAt) {
+			return rotated[i].rotatedAt.Before(rotated[j].rotatedAt)
+		}
+		return rotated[i].n < rotated[j].n
+	})
+
+	paths := make([]string, 0, len(rotated)+1)
+	for _, file := range rotated {
+		paths = append(paths, file.path)
+	}
+	return append(paths, path), nil
+}
+
+// parseRotatedSuffix parses the suffix that rotate adds to the path, a timestamp with an optional -N counter
+func parseRotatedSuffix(suffix string) (rotatedAt time.Time, n int, ok bool) {
+	if len(suffix) < len(_rotatedFileTimeFormat) {
+		return time.Time{}, 0, false
+	}
+
+	timestamp, counter := suffix[:len(_rotatedFileTimeFormat)], suffix[len(_rotatedFileTimeFormat):]
+	rotatedAt, err := time.Parse(_rotatedFileTimeFormat, timestamp)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	if counter == "" {
+		return rotatedAt, 0, true
+	}
+	if !strings.HasPrefix(counter, "-") {
+		return time.Time{}, 0, false
+	}
+	n, err = strconv.Atoi(counter[1:])
+	if err != nil || n < 1 || strconv.Itoa(n) != counter[1:] {
+		return time.Time{}, 0, false
+	}
+	return rotatedAt, n, true
+}
+
+func walkFile(path string, fn func(letter *Letter) error) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return walkLetters(path, NewLetterReader(file), fn)
+}
+
+// walkLetters calls the function for every letter of the reader, the errors of the reader are prefixed with the path
+func walkLetters(path string, reader *LetterReader, fn func(letter *Letter) error) error {
+	for {
+		letter, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := fn(letter); err != nil {
+			return err
+		}
+	}
+}
+
+// rewriteFile writes the letters of the file to a temporary file except the remaining letters and
+// replaces the file with it, so the file is never left half written
+func rewriteFile(path string, remaining map[string]int) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	err = walkFile(path, func(letter *Letter) error {
+		key, err := letterKey(letter)
+		if err != nil {
+			return err
+		}
+		if remaining[key] > 0 {
+			remaining[key]--
+			return nil
+		}
+
+		line, err := json.Marshal(letter)
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(append(line, '\n'))
+		return err
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// letterKey identifies a letter by its id, letters without an id are identified by their content
+func letterKey(letter *Letter) (string, error) {
+	if letter.ID != "" {
+		return letter.ID, nil
+	}
+	b, err := json.Marshal(letter)
+	return string(b), err
+}
+
+// LetterReader reads letters that are written as json lines
+type LetterReader struct {
+	reader *bufio.Reader
+	// skipTornLine ignores a last line without a line break, it is a letter that is still being written
+	skipTornLine bool
+}
+
+// NewLetterReader create a letter reader that reads json lines from the given reader
+func NewLetterReader(r io.Reader) *LetterReader {
+	return &LetterReader{reader: bufio.NewReader(r)}
+}
+
+// Next returns the next letter, io.EOF is returned when there are no more letters
+func (r *LetterReader) Next() (*Letter, error) {
+	for {
+		line, err := r.reader.ReadBytes('\n')
+		if err == io.EOF && r.skipTornLine {
+			return nil, io.EOF
+		}
+		if len(line) == 0 || (len(line) == 1 && line[0] == '\n') {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		var letter Letter
+		if err := json.Unmarshal(line, &letter); err != nil {
+			return nil, err
+		}
+		return &letter, nil
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// escapeGlob escapes the meta characters of the path so it can be used as a literal glob prefix
+func escapeGlob(path string) string {
+	escaped := make([]rune, 0, len(path))
+	for _, r := range path {
+		switch r {
+		case '*', '?', '[', '\\':
+			escaped = append(escaped, '\\')
+		}
+		escaped = append(escaped, r)
+	}
+	return string(escaped)
+}
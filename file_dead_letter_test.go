@@ -0,0 +1,172 @@
+package client_test
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bilginyuksel/client"
+	"github.com/streetbyters/aduket"
+	"github.com/stretchr/testify/assert"
+)
+
+func collectLetters(t *testing.T, deadLetter *client.FileDeadLetter) []*client.Letter {
+	var letters []*client.Letter
+	err := deadLetter.Walk(func(letter *client.Letter) error {
+		letters = append(letters, letter)
+		return nil
+	})
+	assert.Nil(t, err)
+	return letters
+}
+
+func TestFileDeadLetter_Save_AppendLetterAsJSONLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "letters.jsonl")
+	deadLetter, err := client.NewFileDeadLetter(path, client.WithFileSync(client.FileSyncAlways))
+	assert.Nil(t, err)
+
+	letter := &client.Letter{
+		Method:  http.MethodPost,
+		URL:     "http://localhost:3000/orders",
+		Body:    []byte(`{"id":1}`),
+		Headers: map[string][]string{"X-R": {"req"}},
+	}
+	assert.Nil(t, deadLetter.Save(letter))
+	assert.Nil(t, deadLetter.Save(letter))
+	assert.Nil(t, deadLetter.Close())
+
+	content, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(content)), "\n"), 2)
+
+	reopened, err := client.NewFileDeadLetter(path)
+	assert.Nil(t, err)
+	defer reopened.Close()
+	assert.Equal(t, []*client.Letter{letter, letter}, collectLetters(t, reopened))
+}
+
+func TestFileDeadLetter_ReachMaxSize_RotateFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "letters.jsonl")
+	deadLetter, err := client.NewFileDeadLetter(path, client.WithFileMaxSize(150))
+	assert.Nil(t, err)
+	defer deadLetter.Close()
+
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, deadLetter.Save(&client.Letter{Method: http.MethodGet, URL: fmt.Sprintf("http://localhost:3000/%d", i)}))
+	}
+
+	files, _ := os.ReadDir(dir)
+	assert.Greater(t, len(files), 1)
+
+	letters := collectLetters(t, deadLetter)
+	assert.Len(t, letters, 5)
+	for i, letter := range letters {
+		assert.Equal(t, fmt.Sprintf("http://localhost:3000/%d", i), letter.URL)
+	}
+}
+
+func TestFileDeadLetter_ReachMaxAge_RotateFile(t *testing.T) {
+	dir := t.TempDir()
+	deadLetter, err := client.NewFileDeadLetter(filepath.Join(dir, "letters.jsonl"), client.WithFileMaxAge(time.Millisecond))
+	assert.Nil(t, err)
+	defer deadLetter.Close()
+
+	assert.Nil(t, deadLetter.Save(&client.Letter{Method: http.MethodGet}))
+	time.Sleep(5 * time.Millisecond)
+	assert.Nil(t, deadLetter.Save(&client.Letter{Method: http.MethodGet}))
+
+	// the current file, the rotated file and the lock file
+	files, _ := os.ReadDir(dir)
+	assert.Len(t, files, 3)
+	assert.Len(t, collectLetters(t, deadLetter), 2)
+}
+
+func TestFileDeadLetter_ConcurrentSaves_WriteEveryLetter(t *testing.T) {
+	deadLetter, err := client.NewFileDeadLetter(filepath.Join(t.TempDir(), "letters.jsonl"), client.WithFileMaxSize(4096))
+	assert.Nil(t, err)
+	defer deadLetter.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.Nil(t, deadLetter.Save(&client.Letter{Method: http.MethodGet, URL: fmt.Sprintf("/%d", i), Body: []byte(strings.Repeat("a", 100))}))
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Len(t, collectLetters(t, deadLetter), 50)
+}
+
+func TestDo_WithFileDeadLetter_SaveFailedRequest(t *testing.T) {
+	s, _ := aduket.NewServer(http.MethodGet, "/test", aduket.StatusCode(502))
+	deadLetter, err := client.NewFileDeadLetter(filepath.Join(t.TempDir(), "letters.jsonl"))
+	assert.Nil(t, err)
+	defer deadLetter.Close()
+
+	cli := client.New(client.WithHost(s.URL), client.WithDeadLetter(deadLetter), client.WithRetry(0, time.Millisecond))
+	_, _ = cli.Do(ctx, cli.NewRequest().Path("/test"))
+
+	letters := collectLetters(t, deadLetter)
+	assert.Len(t, letters, 1)
+	assert.Equal(t, s.URL+"/test", letters[0].URL)
+}
+
+func TestLetterReader_CorruptedLine_ReturnErr(t *testing.T) {
+	reader := client.NewLetterReader(strings.NewReader("{\"method\":\"GET\"}\n\n{corrupted\n"))
+
+	letter, err := reader.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, http.MethodGet, letter.Method)
+
+	_, err = reader.Next()
+	assert.NotNil(t, err)
+}
+
+func TestFileDeadLetter_UnrelatedSiblingFile_NeitherWalkNorRemoveIt(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "letters")
+	backup := `{"method":"GET","url":"http://localhost:3000/backup"}` + "\n"
+	assert.Nil(t, os.WriteFile(path+".bak", []byte(backup), 0o644))
+
+	deadLetter, err := client.NewFileDeadLetter(path, client.WithFileMaxSize(100))
+	assert.Nil(t, err)
+	defer deadLetter.Close()
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, deadLetter.Save(&client.Letter{Method: http.MethodGet, URL: fmt.Sprintf("http://localhost:3000/%d", i)}))
+	}
+
+	letters := collectLetters(t, deadLetter)
+	assert.Len(t, letters, 3)
+
+	assert.Nil(t, deadLetter.Remove(append(letters, &client.Letter{Method: http.MethodGet, URL: "http://localhost:3000/backup"})...))
+	assert.Empty(t, collectLetters(t, deadLetter))
+
+	content, err := os.ReadFile(path + ".bak")
+	assert.Nil(t, err)
+	assert.Equal(t, backup, string(content))
+}
+
+func TestFileDeadLetter_OpenTwice_ReturnStoreLockedErr(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "letters.jsonl")
+	deadLetter, err := client.NewFileDeadLetter(path)
+	assert.Nil(t, err)
+
+	_, err = client.NewFileDeadLetter(path)
+	assert.ErrorIs(t, err, client.ErrStoreLocked)
+	_, err = client.NewKVDeadLetter(path)
+	assert.ErrorIs(t, err, client.ErrStoreLocked)
+
+	assert.Nil(t, deadLetter.Close())
+	reopened, err := client.NewFileDeadLetter(path)
+	assert.Nil(t, err)
+	assert.Nil(t, reopened.Close())
+}
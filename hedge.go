@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// hedging sends extra copies of a slow idempotent request and uses whichever answers first
+type hedging struct {
+	delay     time.Duration
+	maxHedges int
+}
+
+// hedgeResult is the outcome of a single copy of a hedged request
+type hedgeResult struct {
+	index int
+	res   *http.Response
+	err   error
+	// limited is set if the copy is never sent because the rate limiter did not allow it
+	limited bool
+}
+
+func (c *Client) hedgingFor(request *Request) *hedging {
+	if request.hedging != nil {
+		return request.hedging
+	}
+	return c.hedging
+}
+
+// doHedged sends the request and sends another copy every time the delay passes without a successful response,
+// until max hedges are sent. The first successful response is returned, other copies are cancelled and their bodies are closed
+func (c *Client) doHedged(ctx context.Context, request *Request, h *hedging) (*http.Response, error) {
+	results := make(chan hedgeResult, h.maxHedges+1)
+	cancels := make([]context.CancelFunc, 0, h.maxHedges+1)
+	send := func() {
+		hedgeCtx, cancel := context.WithCancel(ctx)
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			// every copy is a new request for the upstream so it has to respect the rate limiter,
+			// the first copy already waited for it in Do. Waiting here keeps the loop reading the results
+			if index > 0 {
+				if err := c.awaitRateLimiter(hedgeCtx); err != nil {
+					results <- hedgeResult{index: index, err: err, limited: true}
+					return
+				}
+			}
+			res, err := c.do(hedgeCtx, request, 1)
+			results <- hedgeResult{index: index, res: res, err: err}
+		}()
+	}
+
+	send()
+	timer := time.NewTimer(h.delay)
+	defer timer.Stop()
+
+	var failure *hedgeResult
+	for pending := 1; pending > 0; {
+		select {
+		case <-timer.C:
+			if len(cancels) > h.maxHedges {
+				continue
+			}
+			send()
+			pending++
+			timer.Reset(h.delay)
+		case result := <-results:
+			pending--
+			if result.limited {
+				continue
+			}
+			if result.err == nil && !isRetryable(result.res, nil) {
+				c.cancelHedges(results, pending, cancels, result.index)
+				if failure != nil {
+					closeResponse(failure.res)
+				}
+				result.res.Body = &cancelOnCloseBody{ReadCloser: result.res.Body, cancel: cancels[result.index]}
+				return result.res, nil
+			}
+
+			if failure != nil {
+				closeResponse(failure.res)
+				cancels[failure.index]()
+			}
+			failure = &result
+		}
+	}
+
+	if failure.res != nil {
+		failure.res.Body = &cancelOnCloseBody{ReadCloser: failure.res.Body, cancel: cancels[failure.index]}
+	} else {
+		cancels[failure.index]()
+	}
+	return failure.res, failure.err
+}
+
+// cancelHedges cancels every copy except the winner and closes the responses of the pending ones in the background
+func (c *Client) cancelHedges(results chan hedgeResult, pending int, cancels []context.CancelFunc, winner int) {
+	for i, cancel := range cancels {
+		if i != winner {
+			cancel()
+		}
+	}
+
+	go func() {
+		for ; pending > 0; pending-- {
+			closeResponse((<-results).res)
+		}
+	}()
+}
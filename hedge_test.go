@@ -0,0 +1,150 @@
+package client_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bilginyuksel/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func newSlowFirstServer(count *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(count, 1) == 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(500 * time.Millisecond):
+			}
+			_, _ = rw.Write([]byte("slow"))
+			return
+		}
+		_, _ = rw.Write([]byte("fast"))
+	}))
+}
+
+func TestDo_WithHedging_ReturnFirstResponse(t *testing.T) {
+	var count int32
+	s := newSlowFirstServer(&count)
+	defer s.Close()
+
+	cli := client.New(client.WithHost(s.URL), client.WithHedging(20*time.Millisecond, 2))
+
+	startTime := time.Now()
+	res, err := cli.Do(ctx, cli.NewRequest())
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+
+	assert.Equal(t, "fast", string(body))
+	assert.Less(t, time.Since(startTime), 500*time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+}
+
+func TestDo_RequestHedge_OverrideClientHedging(t *testing.T) {
+	var count int32
+	s := newSlowFirstServer(&count)
+	defer s.Close()
+
+	cli := client.New(client.WithHost(s.URL), client.WithHedging(20*time.Millisecond, 2))
+	res, err := cli.Do(ctx, cli.NewRequest().Hedge(0, 0))
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+
+	assert.Equal(t, "slow", string(body))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+}
+
+func TestDo_HedgingNonIdempotentRequest_SendOnlyOnce(t *testing.T) {
+	var count int32
+	s := newSlowFirstServer(&count)
+	defer s.Close()
+
+	cli := client.New(client.WithHost(s.URL), client.WithHedging(20*time.Millisecond, 2))
+	res, err := cli.Do(ctx, cli.NewRequest().Method(http.MethodPost))
+	assert.Nil(t, err)
+	res.Body.Close()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+}
+
+func TestDo_HedgingAllFailed_ReturnFailedResponse(t *testing.T) {
+	var count int32
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		time.Sleep(30 * time.Millisecond)
+		rw.WriteHeader(500)
+	}))
+	defer s.Close()
+
+	cli := client.New(client.WithHost(s.URL), client.WithRetry(0, time.Millisecond), client.WithHedging(10*time.Millisecond, 2))
+	res, err := cli.Do(ctx, cli.NewRequest())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 500, res.StatusCode)
+	res.Body.Close()
+	assert.Equal(t, int32(3), atomic.LoadInt32(&count))
+}
+
+func TestDo_HedgingWithRateLimit_DoNotWaitForLimiterToReturnWinner(t *testing.T) {
+	var count int32
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		time.Sleep(30 * time.Millisecond)
+	}))
+	defer s.Close()
+
+	cli := client.New(client.WithHost(s.URL), client.WithRateLimit(500*time.Millisecond, 1), client.WithHedging(10*time.Millisecond, 1))
+
+	startTime := time.Now()
+	res, err := cli.Do(ctx, cli.NewRequest())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	res.Body.Close()
+	assert.Less(t, time.Since(startTime), 250*time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+}
+
+type trackedBody struct {
+	io.Reader
+	closed int32
+}
+
+func (b *trackedBody) Close() error {
+	atomic.StoreInt32(&b.closed, 1)
+	return nil
+}
+
+type roundTripperFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestDo_HedgedCopyWinsAfterFailedCopy_CloseFailedResponse(t *testing.T) {
+	var count int32
+	failedBody := &trackedBody{Reader: strings.NewReader("failed")}
+	transport := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		if atomic.AddInt32(&count, 1) == 1 {
+			time.Sleep(30 * time.Millisecond)
+			return &http.Response{StatusCode: 500, Body: failedBody, Request: r}, nil
+		}
+		time.Sleep(60 * time.Millisecond)
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader("ok")), Request: r}, nil
+	})
+
+	cli := client.New(client.WithHost("http://localhost"), client.WithHTTPClient(&http.Client{Transport: transport}),
+		client.WithRetry(0, time.Millisecond), client.WithHedging(10*time.Millisecond, 1))
+	res, err := cli.Do(ctx, cli.NewRequest())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	res.Body.Close()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&failedBody.closed))
+}
@@ -0,0 +1,150 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	urlpkg "net/url"
+)
+
+// HTTPDeadLetter is a deadletter that sends letters to a collector endpoint with POST requests.
+// Letters are sent with their own client, so the collector has its own retry policy, and the letters
+// that could not be delivered are saved to the fallback deadletter if there is one
+type HTTPDeadLetter struct {
+	client   *Client
+	url      string
+	query    urlpkg.Values
+	batch    bool
+	fallback DeadLetterV2
+}
+
+// HTTPDeadLetterOption is a function that configures an http deadletter
+type HTTPDeadLetterOption func(d *HTTPDeadLetter)
+
+// WithHTTPDeadLetterClient create http deadletter option function with the options of the client that sends the letters
+func WithHTTPDeadLetterClient(opts ...Option) HTTPDeadLetterOption {
+	return func(d *HTTPDeadLetter) {
+		d.client = New(opts...)
+	}
+}
+
+// WithHTTPDeadLetterBatch create http deadletter option function that sends the letters saved together
+// in a single request as newline delimited json
+func WithHTTPDeadLetterBatch() HTTPDeadLetterOption {
+	return func(d *HTTPDeadLetter) {
+		d.batch = true
+	}
+}
+
+// WithHTTPDeadLetterFallback create http deadletter option function with a deadletter
+// that keeps the letters when the collector is unreachable
+func WithHTTPDeadLetterFallback(fallback DeadLetterV2) HTTPDeadLetterOption {
+	return func(d *HTTPDeadLetter) {
+		d.fallback = fallback
+	}
+}
+
+// NewHTTPDeadLetter create an http deadletter that posts letters to the given url
+func NewHTTPDeadLetter(url string, opts ...HTTPDeadLetterOption) *HTTPDeadLetter {
+	d := &HTTPDeadLetter{
+		client: New(),
+		url:    url,
+	}
+	// the query of the url is sent with every request, the request would drop it if it stays in the host.
+	// An invalid url is kept as it is, so sending the letters reports the error
+	if parsed, err := urlpkg.Parse(url); err == nil && parsed.RawQuery != "" {
+		d.query = parsed.Query()
+		parsed.RawQuery = ""
+		d.url = parsed.String()
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+// Save sends the letter to the collector
+func (d *HTTPDeadLetter) Save(letter *Letter) error {
+	return d.SaveLetters(context.Background(), letter)
+}
+
+// SaveLetters sends the letters to the collector, one request per letter or a single request in batch mode.
+// The letters that could not be sent are saved to the fallback deadletter
+func (d *HTTPDeadLetter) SaveLetters(ctx context.Context, letters ...*Letter) error {
+	if len(letters) == 0 {
+		return nil
+	}
+
+	if d.batch {
+		return d.withFallback(ctx, letters, d.send(ctx, letters...))
+	}
+
+	for i, letter := range letters {
+		if err := d.send(ctx, letter); err != nil {
+			return d.withFallback(ctx, letters[i:], err)
+		}
+	}
+	return nil
+}
+
+// send posts the letters, a single letter is sent as json and a batch is sent as newline delimited json
+func (d *HTTPDeadLetter) send(ctx context.Context, letters ...*Letter) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, letter := range letters {
+		if err := encoder.Encode(letter); err != nil {
+			return err
+		}
+	}
+
+	request := d.client.NewRequest().
+		Host(d.url).
+		Method(http.MethodPost).
+		Body(body.Bytes()).
+		SkipDeadLetter()
+	for key, values := range d.query {
+		request.SetQuery(key, values...)
+	}
+	if d.batch {
+		request.SetHeader("Content-Type", "application/x-ndjson")
+	} else {
+		request.SetHeader("Content-Type", "application/json")
+	}
+
+	// letters can be sent again safely because the collector can drop duplicates by the key
+	if len(letters) == 1 && letters[0].ID != "" {
+		request.IdempotencyKey(letters[0].ID)
+	} else {
+		request.Idempotent()
+	}
+
+	res, err := d.client.Do(ctx, request)
+	if err != nil {
+		return err
+	}
+	defer closeResponse(res)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("collector responded with status code %d", res.StatusCode)
+	}
+	return nil
+}
+
+func (d *HTTPDeadLetter) withFallback(ctx context.Context, letters []*Letter, err error) error {
+	if err == nil || d.fallback == nil {
+		return err
+	}
+
+	if ctx.Err() != nil {
+		ctx = detachedContext{Context: ctx}
+	}
+	if fallbackErr := d.fallback.SaveLetters(ctx, letters...); fallbackErr != nil {
+		return fmt.Errorf("letters could not sent to collector: %v, fallback failed: %w", err, fallbackErr)
+	}
+	return nil
+}
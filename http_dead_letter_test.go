@@ -0,0 +1,144 @@
+package client_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bilginyuksel/client"
+	"github.com/stretchr/testify/assert"
+)
+
+type collector struct {
+	mu              sync.Mutex
+	contentTypes    []string
+	idempotencyKeys []string
+	letters         []*client.Letter
+	failures        int
+}
+
+func (c *collector) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.failures > 0 {
+		c.failures--
+		rw.WriteHeader(503)
+		return
+	}
+
+	c.contentTypes = append(c.contentTypes, r.Header.Get("Content-Type"))
+	c.idempotencyKeys = append(c.idempotencyKeys, r.Header.Get("Idempotency-Key"))
+	reader := client.NewLetterReader(r.Body)
+	for {
+		letter, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			rw.WriteHeader(400)
+			return
+		}
+		c.letters = append(c.letters, letter)
+	}
+	rw.WriteHeader(202)
+}
+
+func TestHTTPDeadLetter_Save_PostLetterAsJSON(t *testing.T) {
+	c := &collector{}
+	s := httptest.NewServer(c)
+
+	deadLetter := client.NewHTTPDeadLetter(s.URL + "/letters")
+	letter := &client.Letter{ID: "1", Method: http.MethodGet, URL: "http://localhost/orders"}
+	assert.Nil(t, deadLetter.Save(letter))
+
+	assert.Equal(t, []*client.Letter{letter}, c.letters)
+	assert.Equal(t, []string{"application/json"}, c.contentTypes)
+	assert.Equal(t, []string{"1"}, c.idempotencyKeys)
+}
+
+func TestHTTPDeadLetter_Batch_PostLettersAsNDJSON(t *testing.T) {
+	c := &collector{}
+	s := httptest.NewServer(c)
+
+	deadLetter := client.NewHTTPDeadLetter(s.URL, client.WithHTTPDeadLetterBatch())
+	err := deadLetter.SaveLetters(ctx, &client.Letter{ID: "1"}, &client.Letter{ID: "2"}, &client.Letter{ID: "3"})
+
+	assert.Nil(t, err)
+	assert.Len(t, c.letters, 3)
+	assert.Equal(t, []string{"application/x-ndjson"}, c.contentTypes)
+}
+
+func TestHTTPDeadLetter_CollectorFailsOnce_RetryWithOwnPolicy(t *testing.T) {
+	c := &collector{failures: 1}
+	s := httptest.NewServer(c)
+
+	deadLetter := client.NewHTTPDeadLetter(s.URL,
+		client.WithHTTPDeadLetterClient(client.WithRetryPolicy(client.NewConstantRetryPolicy(1, time.Millisecond))))
+
+	assert.Nil(t, deadLetter.Save(&client.Letter{ID: "1"}))
+	assert.Len(t, c.letters, 1)
+}
+
+func TestHTTPDeadLetter_CollectorUnreachable_SaveToFallback(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	s.Close()
+
+	fallback := &recordingDeadLetter{}
+	deadLetter := client.NewHTTPDeadLetter(s.URL,
+		client.WithHTTPDeadLetterClient(client.WithRetry(1, time.Millisecond)),
+		client.WithHTTPDeadLetterFallback(fallback))
+
+	err := deadLetter.SaveLetters(ctx, &client.Letter{ID: "1"}, &client.Letter{ID: "2"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []int{2}, fallback.batchSizes())
+}
+
+func TestHTTPDeadLetter_CollectorRejects_ReturnErrWithoutFallback(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(400)
+	}))
+
+	err := client.NewHTTPDeadLetter(s.URL).Save(&client.Letter{})
+
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "400"))
+}
+
+func TestDo_WithHTTPDeadLetter_ForwardFailedRequestToCollector(t *testing.T) {
+	c := &collector{}
+	collectorServer := httptest.NewServer(c)
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(500)
+	}))
+
+	cli := client.New(client.WithHost(upstream.URL),
+		client.WithRetry(0, time.Millisecond),
+		client.WithDeadLetterV2(client.NewHTTPDeadLetter(collectorServer.URL)))
+	_, err := cli.Do(ctx, cli.NewRequest().Path("/orders"))
+
+	assert.Nil(t, err)
+	assert.Len(t, c.letters, 1)
+	assert.Equal(t, upstream.URL+"/orders", c.letters[0].URL)
+	letterJSON, _ := json.Marshal(c.letters[0])
+	assert.Contains(t, string(letterJSON), `"statusCode":500`)
+}
+
+func TestHTTPDeadLetter_URLWithQuery_SendQuery(t *testing.T) {
+	var uri string
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		uri = r.URL.RequestURI()
+	}))
+	defer s.Close()
+
+	err := client.NewHTTPDeadLetter(s.URL + "/letters?token=abc&team=payments").Save(&client.Letter{ID: "1"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "/letters?team=payments&token=abc", uri)
+}
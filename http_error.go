@@ -0,0 +1,84 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const (
+	// _maxErrorResponseBody is the maximum number of response body bytes kept in an HTTPError
+	_maxErrorResponseBody = 4 << 10
+	// _maxErrorDecodeBody is the maximum number of response body bytes decoded into the error type
+	_maxErrorDecodeBody = 1 << 20
+)
+
+// HTTPError is returned by Parse, ParseJSON and ParseXML when the response status code is not a success
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	Method     string
+	URL        string
+	Header     http.Header
+	// Body is the beginning of the response body, at most 4KB
+	Body []byte
+	// Err is the body decoded into the error type of the request or the client, or into ProblemDetails.
+	// Up to 1MB of the body is decoded. It is nil if there is no error type or the body could not be decoded
+	Err error
+}
+
+func (e *HTTPError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s %s: unexpected status %s: %v", e.Method, e.URL, e.Status, e.Err)
+	}
+	return fmt.Sprintf("%s %s: unexpected status %s", e.Method, e.URL, e.Status)
+}
+
+// Unwrap returns the decoded error body, so errors.As can find it
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// newHTTPError reads the beginning of the response body into the error and closes the body.
+// The returned body is longer than the body of the error, it is read to decode the error type
+func newHTTPError(request *Request, res *http.Response) (*HTTPError, []byte) {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, _maxErrorDecodeBody))
+	closeResponse(res)
+
+	snippet := body
+	if len(snippet) > _maxErrorResponseBody {
+		snippet = append([]byte(nil), body[:_maxErrorResponseBody]...)
+	}
+
+	httpErr := &HTTPError{
+		StatusCode: res.StatusCode,
+		Status:     res.Status,
+		Method:     request.method,
+		Header:     res.Header,
+		Body:       snippet,
+	}
+	if httpErr.Status == "" {
+		httpErr.Status = fmt.Sprintf("%d %s", res.StatusCode, http.StatusText(res.StatusCode))
+	}
+	if res.Request != nil && res.Request.URL != nil {
+		httpErr.Method = res.Request.Method
+		httpErr.URL = res.Request.URL.String()
+	} else {
+		httpErr.URL, _ = request.URL()
+	}
+	return httpErr, body
+}
+
+// isSuccess reports whether the status code is one of the success status codes of the client, 2XX by default
+func (c *Client) isSuccess(statusCode int) bool {
+	if len(c.successStatusCodes) == 0 {
+		return statusCode >= 200 && statusCode <= 299
+	}
+
+	for _, successStatusCode := range c.successStatusCodes {
+		if statusCode == successStatusCode {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+package client_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bilginyuksel/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseJSON_NonSuccessStatusCode_ReturnHTTPError(t *testing.T) {
+	testCases := []struct {
+		scenario     string
+		givenStatus  int
+		givenBody    string
+		expectedBody string
+	}{
+		{
+			scenario:     "404 html page",
+			givenStatus:  404,
+			givenBody:    "<html>not found</html>",
+			expectedBody: "<html>not found</html>",
+		},
+		{
+			scenario:     "500 with a json body",
+			givenStatus:  500,
+			givenBody:    `{"firstname":"error"}`,
+			expectedBody: `{"firstname":"error"}`,
+		},
+		{
+			scenario:     "large body is cut",
+			givenStatus:  400,
+			givenBody:    strings.Repeat("a", 10000),
+			expectedBody: strings.Repeat("a", 4096),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				rw.Header().Set("X-Trace-Id", "trace")
+				rw.WriteHeader(tc.givenStatus)
+				_, _ = rw.Write([]byte(tc.givenBody))
+			}))
+			defer s.Close()
+
+			cli := client.New(client.WithHost(s.URL), client.WithRetry(0, time.Millisecond))
+			var response struct {
+				Firstname string `json:"firstname"`
+			}
+			err := cli.ParseJSON(ctx, cli.NewRequest().Path("/orders").AddQuery("id", "1"), &response)
+
+			var httpErr *client.HTTPError
+			assert.True(t, errors.As(err, &httpErr))
+			assert.Equal(t, tc.givenStatus, httpErr.StatusCode)
+			assert.Equal(t, http.MethodGet, httpErr.Method)
+			assert.Equal(t, s.URL+"/orders?id=1", httpErr.URL)
+			assert.Equal(t, "trace", httpErr.Header.Get("X-Trace-Id"))
+			assert.Equal(t, tc.expectedBody, string(httpErr.Body))
+			assert.Empty(t, response.Firstname)
+		})
+	}
+}
+
+func TestParseJSON_WithSuccessStatusCodes_ParseOnlyGivenStatusCodes(t *testing.T) {
+	var status int
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(status)
+		_, _ = rw.Write([]byte(`{"firstname":"john"}`))
+	}))
+	defer s.Close()
+
+	cli := client.New(client.WithHost(s.URL), client.WithSuccessStatusCodes(200, 404))
+	var response struct {
+		Firstname string `json:"firstname"`
+	}
+
+	status = 404
+	assert.Nil(t, cli.ParseJSON(ctx, cli.NewRequest(), &response))
+	assert.Equal(t, "john", response.Firstname)
+
+	status = 201
+	var httpErr *client.HTTPError
+	assert.True(t, errors.As(cli.ParseJSON(ctx, cli.NewRequest(), &response), &httpErr))
+	assert.Equal(t, 201, httpErr.StatusCode)
+	assert.Equal(t, "GET "+s.URL+": unexpected status 201 Created", httpErr.Error())
+}
+
+type apiError struct {
+	Message string `json:"message" xml:"message"`
+	Code    int    `json:"code" xml:"code"`
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+type otherAPIError struct {
+	Reason string `json:"reason"`
+}
+
+func (e *otherAPIError) Error() string {
+	return e.Reason
+}
+
+func newErrorServer(contentType, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", contentType)
+		rw.WriteHeader(422)
+		_, _ = rw.Write([]byte(body))
+	}))
+}
+
+func TestParseJSON_WithErrorType_DecodeErrorBody(t *testing.T) {
+	s := newErrorServer("application/json", `{"message":"invalid order","code":1000,"reason":"stock"}`)
+	defer s.Close()
+
+	cli := client.New(client.WithHost(s.URL), client.WithErrorType(func() error { return &apiError{} }))
+	err := cli.GetJSON(ctx, cli.NewRequest(), &struct{}{})
+
+	var httpErr *client.HTTPError
+	var apiErr *apiError
+	assert.True(t, errors.As(err, &httpErr))
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, &apiError{Message: "invalid order", Code: 1000}, apiErr)
+	assert.Equal(t, "GET "+s.URL+": unexpected status 422 Unprocessable Entity: invalid order", err.Error())
+
+	err = cli.GetJSON(ctx, cli.NewRequest().ErrorType(func() error { return &otherAPIError{} }), &struct{}{})
+
+	var otherErr *otherAPIError
+	assert.False(t, errors.As(err, &apiErr))
+	assert.True(t, errors.As(err, &otherErr))
+	assert.Equal(t, "stock", otherErr.Reason)
+}
+
+func TestParseXML_WithErrorTypeAndXMLBody_DecodeXMLErrorBody(t *testing.T) {
+	s := newErrorServer("application/xml; charset=utf-8", `<error><message>invalid order</message><code>1000</code></error>`)
+	defer s.Close()
+
+	cli := client.New(client.WithHost(s.URL), client.WithErrorType(func() error { return &apiError{} }))
+	err := cli.GetXML(ctx, cli.NewRequest(), &struct{}{})
+
+	var apiErr *apiError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, 1000, apiErr.Code)
+}
+
+func TestParseJSON_ProblemDetailsResponse_DecodeProblemDetails(t *testing.T) {
+	s := newErrorServer(client.ProblemContentType,
+		`{"type":"https://example.com/out-of-credit","title":"You do not have enough credit.","status":422,"detail":"Your balance is 30","balance":30}`)
+	defer s.Close()
+
+	cli := client.New(client.WithHost(s.URL))
+	err := cli.GetJSON(ctx, cli.NewRequest(), &struct{}{})
+
+	var problem *client.ProblemDetails
+	assert.True(t, errors.As(err, &problem))
+	assert.Equal(t, &client.ProblemDetails{
+		Type:       "https://example.com/out-of-credit",
+		Title:      "You do not have enough credit.",
+		Status:     422,
+		Detail:     "Your balance is 30",
+		Extensions: map[string]interface{}{"balance": float64(30)},
+	}, problem)
+	assert.Equal(t, "You do not have enough credit.: Your balance is 30", problem.Error())
+}
+
+func TestParseJSON_UndecodableErrorBody_ReturnHTTPErrorWithoutErr(t *testing.T) {
+	s := newErrorServer("text/html", "<html>error</html>")
+	defer s.Close()
+
+	cli := client.New(client.WithHost(s.URL), client.WithErrorType(func() error { return &apiError{} }))
+	err := cli.GetJSON(ctx, cli.NewRequest(), &struct{}{})
+
+	var httpErr *client.HTTPError
+	var apiErr *apiError
+	assert.True(t, errors.As(err, &httpErr))
+	assert.Nil(t, httpErr.Err)
+	assert.False(t, errors.As(err, &apiErr))
+}
+
+func TestParseJSON_ErrorBodyLongerThanHTTPErrorBody_DecodeWholeBody(t *testing.T) {
+	message := strings.Repeat("a", 8<<10)
+	s := newErrorServer("application/json", `{"message":"`+message+`","code":1000}`)
+	defer s.Close()
+
+	cli := client.New(client.WithHost(s.URL), client.WithErrorType(func() error { return &apiError{} }))
+	err := cli.GetJSON(ctx, cli.NewRequest(), &struct{}{})
+
+	var httpErr *client.HTTPError
+	var apiErr *apiError
+	assert.True(t, errors.As(err, &httpErr))
+	assert.Len(t, httpErr.Body, 4<<10)
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, &apiError{Message: message, Code: 1000}, apiErr)
+}
@@ -0,0 +1,465 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// _kvCompactThreshold is the number of obsolete records that triggers a compaction of the log
+const _kvCompactThreshold = 1024
+
+const (
+	_kvOpPut     = "put"
+	_kvOpDelete  = "delete"
+	_kvOpLease   = "lease"
+	_kvOpRelease = "release"
+)
+
+var (
+	// ErrLetterNotFound is returned when there is no letter with the given id
+	ErrLetterNotFound = errors.New("letter not found")
+	// ErrLeaseNotHeld is returned when a letter is acknowledged or released by a worker that does not hold its lease
+	ErrLeaseNotHeld = errors.New("lease is not held by the owner")
+)
+
+// KVDeadLetter is a deadletter backed by an embedded append only log on the disk.
+// Every change is a json line that is flushed to the disk before the call returns, and the log is replayed when the
+// store is opened, so a crash loses at most a half written line. Letters can be claimed with a lease, so many replay
+// workers can share the backlog without sending a letter twice
+type KVDeadLetter struct {
+	mu       sync.Mutex
+	path     string
+	file     *os.File
+	lock     *os.File
+	letters  map[string]*kvEntry
+	seq      int64
+	obsolete int
+	now      func() time.Time
+	// writeFile appends to the log, tests replace it to fail in the middle of a write
+	writeFile func(file *os.File, b []byte) (int, error)
+}
+
+type kvEntry struct {
+	seq        int64
+	letter     *Letter
+	leaseOwner string
+	leaseUntil time.Time
+}
+
+type kvRecord struct {
+	Op     string    `json:"op"`
+	ID     string    `json:"id"`
+	Letter *Letter   `json:"letter,omitempty"`
+	Owner  string    `json:"owner,omitempty"`
+	Until  time.Time `json:"until"`
+}
+
+// NewKVDeadLetter opens the store in the given path or creates it if it does not exist.
+// The store is locked until it is closed, opening it again returns ErrStoreLocked
+func NewKVDeadLetter(path string) (*KVDeadLetter, error) {
+	d := &KVDeadLetter{
+		path:      path,
+		letters:   make(map[string]*kvEntry),
+		now:       time.Now,
+		writeFile: (*os.File).Write,
+	}
+
+	lock, err := lockStore(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.load(); err != nil {
+		lock.Close()
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		lock.Close()
+		return nil, err
+	}
+	d.file = file
+	d.lock = lock
+
+	return d, nil
+}
+
+// Save stores the letter, a new id is given to the letter if it does not have one
+func (d *KVDeadLetter) Save(letter *Letter) error {
+	return d.SaveLetters(context.Background(), letter)
+}
+
+// SaveLetters stores the letters, new ids are given to the letters that do not have one
+func (d *KVDeadLetter) SaveLetters(ctx context.Context, letters ...*Letter) error {
+	records := make([]kvRecord, 0, len(letters))
+	for _, letter := range letters {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if letter.ID == "" {
+			id, err := newUUID()
+			if err != nil {
+				return err
+			}
+			letter.ID = id
+		}
+		records = append(records, kvRecord{Op: _kvOpPut, ID: letter.ID, Letter: letter})
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.write(records...)
+}
+
+// Get returns the letter with the given id
+func (d *KVDeadLetter) Get(id string) (*Letter, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	entry, ok := d.letters[id]
+	if !ok {
+		return nil, ErrLetterNotFound
+	}
+	return entry.letter, nil
+}
+
+// List returns every stored letter in the order they are saved
+func (d *KVDeadLetter) List() []*Letter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	entries := d.entries()
+	letters := make([]*Letter, 0, len(entries))
+	for _, entry := range entries {
+		letters = append(letters, entry.letter)
+	}
+	return letters
+}
+
+// Walk calls the given function for every stored letter in the order they are saved
+func (d *KVDeadLetter) Walk(fn func(letter *Letter) error) error {
+	for _, letter := range d.List() {
+		if err := fn(letter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes the letters with the given ids, unknown ids are ignored
+func (d *KVDeadLetter) Delete(ids ...string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	records := make([]kvRecord, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := d.letters[id]; ok {
+			records = append(records, kvRecord{Op: _kvOpDelete, ID: id})
+		}
+	}
+	return d.write(records...)
+}
+
+// Remove deletes the given letters, so the store can be used as a LetterRemover by a replayer
+func (d *KVDeadLetter) Remove(letters ...*Letter) error {
+	ids := make([]string, 0, len(letters))
+	for _, letter := range letters {
+		ids = append(ids, letter.ID)
+	}
+	return d.Delete(ids...)
+}
+
+// Claim leases up to n letters that are not leased by another owner for the given duration.
+// Leases are stored on the disk, so they are kept after a restart until they expire
+func (d *KVDeadLetter) Claim(owner string, n int, lease time.Duration) ([]*Letter, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	until := now.Add(lease)
+
+	var (
+		letters []*Letter
+		records []kvRecord
+	)
+	for _, entry := range d.entries() {
+		if len(letters) >= n {
+			break
+		}
+		if entry.leaseOwner != "" && entry.leaseUntil.After(now) {
+			continue
+		}
+		letters = append(letters, entry.letter)
+		records = append(records, kvRecord{Op: _kvOpLease, ID: entry.letter.ID, Owner: owner, Until: until})
+	}
+
+	if err := d.write(records...); err != nil {
+		return nil, err
+	}
+	return letters, nil
+}
+
+// Ack removes the letter after the owner of its lease processed it
+func (d *KVDeadLetter) Ack(owner, id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.checkLease(owner, id); err != nil {
+		return err
+	}
+	return d.write(kvRecord{Op: _kvOpDelete, ID: id})
+}
+
+// Release gives the lease of the letter back, so it can be claimed again before the lease expires
+func (d *KVDeadLetter) Release(owner, id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.checkLease(owner, id); err != nil {
+		return err
+	}
+	return d.write(kvRecord{Op: _kvOpRelease, ID: id})
+}
+
+// Compact rewrites the log with only the stored letters and their active leases
+func (d *KVDeadLetter) Compact() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.compact()
+}
+
+// Close closes the log file
+func (d *KVDeadLetter) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.file == nil {
+		return nil
+	}
+	err := d.file.Close()
+	d.file = nil
+	d.lock.Close()
+	return err
+}
+
+// checkLease returns an error if the owner does not hold an active lease of the letter, the caller must hold the lock
+func (d *KVDeadLetter) checkLease(owner, id string) error {
+	entry, ok := d.letters[id]
+	if !ok {
+		return ErrLetterNotFound
+	}
+	if entry.leaseOwner != owner || !entry.leaseUntil.After(d.now()) {
+		return ErrLeaseNotHeld
+	}
+	return nil
+}
+
+// write appends the records to the log, flushes them to the disk and applies them, the caller must hold the lock
+func (d *KVDeadLetter) write(records ...kvRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if d.file == nil {
+		return os.ErrClosed
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+
+	// a failed write can leave a partial line behind, it is cut so the next records do not follow a broken line
+	offset, err := d.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	_, err = d.writeFile(d.file, buf.Bytes())
+	if err == nil {
+		err = d.file.Sync()
+	}
+	if err != nil {
+		if truncateErr := d.file.Truncate(offset); truncateErr != nil {
+			return fmt.Errorf("%v, and the log could not be truncated: %v", err, truncateErr)
+		}
+		return err
+	}
+
+	for _, record := range records {
+		d.apply(record)
+	}
+
+	if d.obsolete >= _kvCompactThreshold && d.obsolete > len(d.letters) {
+		return d.compact()
+	}
+	return nil
+}
+
+// apply changes the in memory state with the record, the caller must hold the lock
+func (d *KVDeadLetter) apply(record kvRecord) {
+	entry, exists := d.letters[record.ID]
+	switch record.Op {
+	case _kvOpPut:
+		if exists {
+			d.obsolete++
+			entry.letter = record.Letter
+			return
+		}
+		d.seq++
+		d.letters[record.ID] = &kvEntry{seq: d.seq, letter: record.Letter}
+	case _kvOpDelete:
+		if exists {
+			delete(d.letters, record.ID)
+			// both the put and the delete record are obsolete now
+			d.obsolete += 2
+		}
+	case _kvOpLease:
+		if exists {
+			if entry.leaseOwner != "" {
+				d.obsolete++
+			}
+			entry.leaseOwner = record.Owner
+			entry.leaseUntil = record.Until
+		}
+	case _kvOpRelease:
+		if exists {
+			entry.leaseOwner = ""
+			entry.leaseUntil = time.Time{}
+			d.obsolete += 2
+		}
+	}
+}
+
+// load replays the log into memory. A broken last line is the trace of a crash in the middle of a write,
+// so it is cut from the log. A broken line before the last one means the log is corrupted
+func (d *KVDeadLetter) load() error {
+	file, err := os.OpenFile(d.path, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	offset, torn, err := readKVLog(d.path, file, d.apply)
+	if err != nil {
+		return err
+	}
+	if torn {
+		return file.Truncate(offset)
+	}
+	return nil
+}
+
+// readKVLog applies every record of the log and returns the offset after the last complete record.
+// Torn is true if the last line is broken, a broken line before the last one is returned as an error
+func readKVLog(path string, r io.Reader, apply func(record kvRecord)) (offset int64, torn bool, err error) {
+	var (
+		reader = bufio.NewReader(r)
+		lineNo int
+	)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			lineNo++
+			var record kvRecord
+			if err := json.Unmarshal(line, &record); err != nil || line[len(line)-1] != '\n' {
+				if _, peekErr := reader.Peek(1); peekErr == io.EOF {
+					return offset, true, nil
+				}
+				return offset, false, fmt.Errorf("%s: corrupted record at line %d: %v", path, lineNo, err)
+			}
+			apply(record)
+			offset += int64(len(line))
+		}
+
+		if readErr == io.EOF {
+			return offset, false, nil
+		}
+		if readErr != nil {
+			return offset, false, readErr
+		}
+	}
+}
+
+// compact rewrites the log into a temporary file and replaces the log with it, the caller must hold the lock
+func (d *KVDeadLetter) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(d.path), filepath.Base(d.path)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	now := d.now()
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range d.entries() {
+		id := entry.letter.ID
+		if err := encoder.Encode(kvRecord{Op: _kvOpPut, ID: id, Letter: entry.letter}); err != nil {
+			tmp.Close()
+			return err
+		}
+		if entry.leaseOwner != "" && entry.leaseUntil.After(now) {
+			if err := encoder.Encode(kvRecord{Op: _kvOpLease, ID: id, Owner: entry.leaseOwner, Until: entry.leaseUntil}); err != nil {
+				tmp.Close()
+				return err
+			}
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if d.file != nil {
+		if err := d.file.Close(); err != nil {
+			return err
+		}
+		d.file = nil
+	}
+	if err := os.Rename(tmp.Name(), d.path); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(d.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	d.file = file
+	d.obsolete = 0
+	return nil
+}
+
+// entries returns the stored entries in the order they are saved, the caller must hold the lock
+func (d *KVDeadLetter) entries() []*kvEntry {
+	entries := make([]*kvEntry, 0, len(d.letters))
+	for _, entry := range d.letters {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].seq < entries[j].seq
+	})
+	return entries
+}
@@ -0,0 +1,204 @@
+package client_test
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/bilginyuksel/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKVDeadLetter_SaveGetListDelete(t *testing.T) {
+	deadLetter, err := client.NewKVDeadLetter(filepath.Join(t.TempDir(), "letters.db"))
+	assert.Nil(t, err)
+	defer deadLetter.Close()
+
+	first := &client.Letter{Method: http.MethodGet, URL: "/1"}
+	second := &client.Letter{ID: "second", Method: http.MethodPost, URL: "/2"}
+	assert.Nil(t, deadLetter.Save(first))
+	assert.Nil(t, deadLetter.Save(second))
+
+	assert.NotEmpty(t, first.ID)
+	assert.Equal(t, []*client.Letter{first, second}, deadLetter.List())
+
+	letter, err := deadLetter.Get("second")
+	assert.Nil(t, err)
+	assert.Equal(t, second, letter)
+
+	assert.Nil(t, deadLetter.Delete(first.ID))
+	_, err = deadLetter.Get(first.ID)
+	assert.Equal(t, client.ErrLetterNotFound, err)
+	assert.Equal(t, []*client.Letter{second}, deadLetter.List())
+}
+
+func TestKVDeadLetter_Reopen_RecoverState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "letters.db")
+	deadLetter, err := client.NewKVDeadLetter(path)
+	assert.Nil(t, err)
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, deadLetter.Save(&client.Letter{ID: fmt.Sprint(i), URL: fmt.Sprintf("/%d", i)}))
+	}
+	assert.Nil(t, deadLetter.Delete("1"))
+	claimed, err := deadLetter.Claim("worker", 1, time.Hour)
+	assert.Nil(t, err)
+	assert.Len(t, claimed, 1)
+	assert.Nil(t, deadLetter.Close())
+
+	// simulate a crash in the middle of a write
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	assert.Nil(t, err)
+	_, _ = file.WriteString(`{"op":"put","id":"3","letter":{"url":`)
+	file.Close()
+
+	reopened, err := client.NewKVDeadLetter(path)
+	assert.Nil(t, err)
+	defer reopened.Close()
+
+	letters := reopened.List()
+	assert.Len(t, letters, 2)
+	assert.Equal(t, "/0", letters[0].URL)
+	assert.Equal(t, "/2", letters[1].URL)
+
+	// the lease of the claimed letter survives the restart
+	claimed, err = reopened.Claim("another-worker", 10, time.Hour)
+	assert.Nil(t, err)
+	assert.Len(t, claimed, 1)
+	assert.Equal(t, "2", claimed[0].ID)
+
+	assert.Nil(t, reopened.Save(&client.Letter{ID: "4"}))
+	assert.Len(t, reopened.List(), 3)
+}
+
+func TestKVDeadLetter_CorruptedRecordInTheMiddle_ReturnErr(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "letters.db")
+	content := "{\"op\":\"put\",\"id\":\"0\",\"letter\":{}}\n{corrupted\n{\"op\":\"put\",\"id\":\"1\",\"letter\":{}}\n"
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0o644))
+
+	_, err := client.NewKVDeadLetter(path)
+	assert.NotNil(t, err)
+}
+
+func TestKVDeadLetter_ConcurrentClaims_NeverClaimLetterTwice(t *testing.T) {
+	deadLetter, err := client.NewKVDeadLetter(filepath.Join(t.TempDir(), "letters.db"))
+	assert.Nil(t, err)
+	defer deadLetter.Close()
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, deadLetter.Save(&client.Letter{URL: fmt.Sprintf("/%d", i)}))
+	}
+
+	var (
+		mu      sync.Mutex
+		claimed = make(map[string]int)
+		wg      sync.WaitGroup
+	)
+	for w := 0; w < 5; w++ {
+		wg.Add(1)
+		go func(owner string) {
+			defer wg.Done()
+			for {
+				letters, err := deadLetter.Claim(owner, 3, time.Minute)
+				assert.Nil(t, err)
+				if len(letters) == 0 {
+					return
+				}
+				for _, letter := range letters {
+					mu.Lock()
+					claimed[letter.ID]++
+					mu.Unlock()
+					assert.Nil(t, deadLetter.Ack(owner, letter.ID))
+				}
+			}
+		}(fmt.Sprintf("worker-%d", w))
+	}
+	wg.Wait()
+
+	assert.Len(t, claimed, 100)
+	for _, count := range claimed {
+		assert.Equal(t, 1, count)
+	}
+	assert.Empty(t, deadLetter.List())
+}
+
+func TestKVDeadLetter_Lease_ExpireAndRelease(t *testing.T) {
+	deadLetter, err := client.NewKVDeadLetter(filepath.Join(t.TempDir(), "letters.db"))
+	assert.Nil(t, err)
+	defer deadLetter.Close()
+
+	assert.Nil(t, deadLetter.Save(&client.Letter{ID: "1"}))
+
+	claimed, _ := deadLetter.Claim("first", 1, 20*time.Millisecond)
+	assert.Len(t, claimed, 1)
+	claimed, _ = deadLetter.Claim("second", 1, time.Minute)
+	assert.Empty(t, claimed)
+	assert.Equal(t, client.ErrLeaseNotHeld, deadLetter.Ack("second", "1"))
+
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, client.ErrLeaseNotHeld, deadLetter.Ack("first", "1"))
+	claimed, _ = deadLetter.Claim("second", 1, time.Minute)
+	assert.Len(t, claimed, 1)
+
+	assert.Nil(t, deadLetter.Release("second", "1"))
+	claimed, _ = deadLetter.Claim("third", 1, time.Minute)
+	assert.Len(t, claimed, 1)
+	assert.Nil(t, deadLetter.Ack("third", "1"))
+	assert.Equal(t, client.ErrLetterNotFound, deadLetter.Ack("third", "1"))
+}
+
+func TestKVDeadLetter_Compact_KeepLettersAndLeases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "letters.db")
+	deadLetter, err := client.NewKVDeadLetter(path)
+	assert.Nil(t, err)
+
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, deadLetter.Save(&client.Letter{ID: fmt.Sprint(i)}))
+	}
+	for i := 0; i < 48; i++ {
+		assert.Nil(t, deadLetter.Delete(fmt.Sprint(i)))
+	}
+	_, _ = deadLetter.Claim("worker", 1, time.Hour)
+
+	before, _ := os.Stat(path)
+	assert.Nil(t, deadLetter.Compact())
+	after, _ := os.Stat(path)
+	assert.Less(t, after.Size(), before.Size())
+	assert.Nil(t, deadLetter.Close())
+
+	reopened, err := client.NewKVDeadLetter(path)
+	assert.Nil(t, err)
+	defer reopened.Close()
+
+	assert.Len(t, reopened.List(), 2)
+	claimed, _ := reopened.Claim("another-worker", 10, time.Hour)
+	assert.Len(t, claimed, 1)
+	assert.Equal(t, "49", claimed[0].ID)
+}
+
+func TestKVDeadLetter_WriteFailsInTheMiddle_CutPartialRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "letters.db")
+	deadLetter, err := client.NewKVDeadLetter(path)
+	assert.Nil(t, err)
+
+	assert.Nil(t, deadLetter.Save(&client.Letter{ID: "1"}))
+	client.FailKVWritesAfter(deadLetter, 10, syscall.ENOSPC)
+	assert.ErrorIs(t, deadLetter.Save(&client.Letter{ID: "2"}), syscall.ENOSPC)
+	assert.Nil(t, deadLetter.Save(&client.Letter{ID: "3"}))
+	assert.Nil(t, deadLetter.Close())
+
+	deadLetter, err = client.NewKVDeadLetter(path)
+	assert.Nil(t, err)
+	defer deadLetter.Close()
+
+	var ids []string
+	for _, letter := range deadLetter.List() {
+		ids = append(ids, letter.ID)
+	}
+	assert.Equal(t, []string{"1", "3"}, ids)
+}
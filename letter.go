@@ -1,11 +1,32 @@
 package client
 
+import "time"
+
 // Letter is a letter that is sent to deadletter
 type Letter struct {
+	ID      string              `json:"id"`
 	Method  string              `json:"method"`
 	URL     string              `json:"url"`
 	Body    []byte              `json:"body"`
 	Headers map[string][]string `json:"headers"`
+	Tags    map[string]string   `json:"tags,omitempty"`
+	// BodyTruncated is set if the request body was streamed and only its beginning is kept, such letters can not be replayed
+	BodyTruncated bool `json:"bodyTruncated,omitempty"`
+
+	// Attempts is the number of attempts that were sent before the request is dead-lettered
+	Attempts       int       `json:"attempts"`
+	FirstAttemptAt time.Time `json:"firstAttemptAt"`
+	LastAttemptAt  time.Time `json:"lastAttemptAt"`
+	// StatusCode is the status code of the last response, zero if the last attempt has no response
+	StatusCode int `json:"statusCode,omitempty"`
+	// ResponseBody is the beginning of the last response body
+	ResponseBody []byte `json:"responseBody,omitempty"`
+	// Error is the error of the last attempt
+	Error string `json:"error,omitempty"`
+	// Encryption is set if the body is encrypted, see DecryptLetter
+	Encryption *LetterEncryption `json:"encryption,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
 }
 
 // DeadLetter save request to somewhere to ensure consistency
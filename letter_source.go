@@ -0,0 +1,89 @@
+package client
+
+import (
+	"os"
+	"time"
+)
+
+// fileLetterSource reads the letters of a file deadletter without locking or changing it
+type fileLetterSource struct {
+	path string
+}
+
+// NewFileLetterSource create a read only letter source of the file deadletter in the given path.
+// The store is neither locked nor changed, so it can be read while a service writes to it.
+// A letter that is still being written is skipped
+func NewFileLetterSource(path string) LetterSource {
+	return &fileLetterSource{path: path}
+}
+
+// Walk calls the given function for every stored letter, from the oldest rotated file to the current file.
+// The files are opened before they are read, so a rotation while walking does not hide letters
+func (s *fileLetterSource) Walk(fn func(letter *Letter) error) error {
+	paths, err := storeFiles(s.path)
+	if err != nil {
+		return err
+	}
+
+	files := make([]*os.File, 0, len(paths))
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		files = append(files, file)
+	}
+
+	for _, file := range files {
+		reader := NewLetterReader(file)
+		reader.skipTornLine = true
+		if err := walkLetters(file.Name(), reader, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// kvLetterSource reads the letters of a kv deadletter without locking or changing it
+type kvLetterSource struct {
+	path string
+}
+
+// NewKVLetterSource create a read only letter source of the kv deadletter in the given path.
+// The store is neither locked nor changed, so it can be read while a service writes to it.
+// A record that is still being written is skipped
+func NewKVLetterSource(path string) LetterSource {
+	return &kvLetterSource{path: path}
+}
+
+// Walk calls the given function for every stored letter in the order they are saved
+func (s *kvLetterSource) Walk(fn func(letter *Letter) error) error {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	state := &KVDeadLetter{path: s.path, letters: make(map[string]*kvEntry), now: time.Now}
+	if _, _, err := readKVLog(s.path, file, state.apply); err != nil {
+		return err
+	}
+
+	for _, entry := range state.entries() {
+		if err := fn(entry.letter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package client_test
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bilginyuksel/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func walkSource(t *testing.T, source client.LetterSource) []*client.Letter {
+	var letters []*client.Letter
+	err := source.Walk(func(letter *client.Letter) error {
+		letters = append(letters, letter)
+		return nil
+	})
+	assert.Nil(t, err)
+	return letters
+}
+
+func TestFileLetterSource_StoreOpenByService_ReadWithoutChangingStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "letters.jsonl")
+	deadLetter, err := client.NewFileDeadLetter(path, client.WithFileMaxSize(100))
+	assert.Nil(t, err)
+	defer deadLetter.Close()
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, deadLetter.Save(&client.Letter{Method: http.MethodGet, URL: fmt.Sprintf("http://localhost:3000/%d", i)}))
+	}
+
+	// a letter that is still being written by the service
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	assert.Nil(t, err)
+	_, _ = file.WriteString(`{"method":"GET","url":`)
+	file.Close()
+
+	letters := walkSource(t, client.NewFileLetterSource(path))
+	assert.Len(t, letters, 3)
+	for i, letter := range letters {
+		assert.Equal(t, fmt.Sprintf("http://localhost:3000/%d", i), letter.URL)
+	}
+
+	content, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), `{"method":"GET","url":`)
+}
+
+func TestKVLetterSource_StoreOpenByService_ReadWithoutChangingStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "letters.db")
+	deadLetter, err := client.NewKVDeadLetter(path)
+	assert.Nil(t, err)
+	defer deadLetter.Close()
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, deadLetter.Save(&client.Letter{ID: fmt.Sprint(i), URL: fmt.Sprintf("/%d", i)}))
+	}
+	assert.Nil(t, deadLetter.Delete("1"))
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	assert.Nil(t, err)
+	_, _ = file.WriteString(`{"op":"put","id":"3","letter":{"url":`)
+	file.Close()
+	before, err := os.ReadFile(path)
+	assert.Nil(t, err)
+
+	letters := walkSource(t, client.NewKVLetterSource(path))
+	assert.Len(t, letters, 2)
+	assert.Equal(t, "/0", letters[0].URL)
+	assert.Equal(t, "/2", letters[1].URL)
+
+	after, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, before, after)
+}
+
+func TestKVLetterSource_CorruptedRecordInTheMiddle_ReturnErr(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "letters.db")
+	content := "{\"op\":\"put\",\"id\":\"0\",\"letter\":{}}\n{corrupted\n{\"op\":\"put\",\"id\":\"1\",\"letter\":{}}\n"
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0o644))
+
+	err := client.NewKVLetterSource(path).Walk(func(letter *client.Letter) error { return nil })
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,168 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const _defaultFileContentType = "application/octet-stream"
+
+// ErrBodyNotRewindable is returned when a body that can only be read once is needed again,
+// such as by a retry or by a deadletter
+var ErrBodyNotRewindable = errors.New("request body is not rewindable")
+
+// ErrLetterBodyTruncated is returned when a letter whose streamed body is only partially kept is rebuilt as a request
+var ErrLetterBodyTruncated = errors.New("letter body is truncated")
+
+// Multipart builds a multipart/form-data body. Parts are streamed when the request is sent,
+// so files are never loaded into the memory and they are opened again for every attempt
+type Multipart struct {
+	boundary string
+	parts    []multipartPart
+	once     bool
+}
+
+type multipartPart struct {
+	header textproto.MIMEHeader
+	open   func() (io.ReadCloser, error)
+}
+
+// PartOption is a function that configures the headers of a multipart part
+type PartOption func(header textproto.MIMEHeader)
+
+// WithPartContentType create part option function that sets the content type of the part
+func WithPartContentType(contentType string) PartOption {
+	return func(header textproto.MIMEHeader) {
+		header.Set("Content-Type", contentType)
+	}
+}
+
+// WithPartHeader create part option function that sets a header of the part
+func WithPartHeader(key, value string) PartOption {
+	return func(header textproto.MIMEHeader) {
+		header.Set(key, value)
+	}
+}
+
+// NewMultipart create an empty multipart body with a random boundary
+func NewMultipart() *Multipart {
+	return &Multipart{boundary: multipart.NewWriter(nil).Boundary()}
+}
+
+// Field adds a form field
+func (m *Multipart) Field(name, value string, opts ...PartOption) *Multipart {
+	return m.part(formDataHeader(name, ""), func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(value)), nil
+	}, opts)
+}
+
+// File adds a file whose content is opened with the given function every time the request is sent
+func (m *Multipart) File(fieldName, fileName string, open func() (io.ReadCloser, error), opts ...PartOption) *Multipart {
+	return m.part(fileHeader(fieldName, fileName), open, opts)
+}
+
+// FilePath adds the file in the given path, the base of the path is used as the file name
+func (m *Multipart) FilePath(fieldName, path string, opts ...PartOption) *Multipart {
+	return m.File(fieldName, filepath.Base(path), func() (io.ReadCloser, error) {
+		return os.Open(path)
+	}, opts...)
+}
+
+// FileBytes adds a file with the given content
+func (m *Multipart) FileBytes(fieldName, fileName string, content []byte, opts ...PartOption) *Multipart {
+	return m.File(fieldName, fileName, func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(content)), nil
+	}, opts...)
+}
+
+// FileReader adds a file that is read from the given reader. The reader can only be read once,
+// so the request is neither retried nor saved to a deadletter, use File to upload a file that can be opened again
+func (m *Multipart) FileReader(fieldName, fileName string, r io.Reader, opts ...PartOption) *Multipart {
+	m.once = true
+	return m.File(fieldName, fileName, openOnce(r), opts...)
+}
+
+// FormDataContentType returns the Content-Type header of the body with its boundary
+func (m *Multipart) FormDataContentType() string {
+	w := multipart.NewWriter(nil)
+	_ = w.SetBoundary(m.boundary)
+	return w.FormDataContentType()
+}
+
+func (m *Multipart) part(header textproto.MIMEHeader, open func() (io.ReadCloser, error), opts []PartOption) *Multipart {
+	for _, opt := range opts {
+		opt(header)
+	}
+	m.parts = append(m.parts, multipartPart{header: header, open: open})
+	return m
+}
+
+// clone copies the parts, so the parts added after the body is given to a request do not change the request
+func (m *Multipart) clone() *Multipart {
+	clone := *m
+	clone.parts = append([]multipartPart(nil), m.parts...)
+	return &clone
+}
+
+// open returns a reader that streams the body, the parts are written by another goroutine while the body is read
+func (m *Multipart) open() (io.ReadCloser, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(m.writeTo(pw))
+	}()
+	return pr, nil
+}
+
+func (m *Multipart) writeTo(w io.Writer) error {
+	writer := multipart.NewWriter(w)
+	if err := writer.SetBoundary(m.boundary); err != nil {
+		return err
+	}
+
+	for _, part := range m.parts {
+		if err := writePart(writer, part); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+func writePart(writer *multipart.Writer, part multipartPart) error {
+	content, err := part.open()
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	w, err := writer.CreatePart(part.header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, content)
+	return err
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func formDataHeader(name, fileName string) textproto.MIMEHeader {
+	header := make(textproto.MIMEHeader)
+	disposition := fmt.Sprintf(`form-data; name="%s"`, quoteEscaper.Replace(name))
+	if fileName != "" {
+		disposition += fmt.Sprintf(`; filename="%s"`, quoteEscaper.Replace(fileName))
+	}
+	header.Set("Content-Disposition", disposition)
+	return header
+}
+
+func fileHeader(fieldName, fileName string) textproto.MIMEHeader {
+	header := formDataHeader(fieldName, fileName)
+	header.Set("Content-Type", _defaultFileContentType)
+	return header
+}
@@ -0,0 +1,151 @@
+package client_test
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bilginyuksel/client"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+type receivedPart struct {
+	formName    string
+	fileName    string
+	contentType string
+	header      string
+	content     string
+}
+
+// newMultipartServer records the parts of every request and answers with the given status codes in order
+func newMultipartServer(mu *sync.Mutex, received *[][]receivedPart, statusCodes ...int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		reader := multipart.NewReader(r.Body, params["boundary"])
+
+		var parts []receivedPart
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				break
+			}
+			content, _ := io.ReadAll(part)
+			parts = append(parts, receivedPart{
+				formName:    part.FormName(),
+				fileName:    part.FileName(),
+				contentType: part.Header.Get("Content-Type"),
+				header:      part.Header.Get("X-Checksum"),
+				content:     string(content),
+			})
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		*received = append(*received, parts)
+		if len(*received) <= len(statusCodes) {
+			rw.WriteHeader(statusCodes[len(*received)-1])
+		}
+	}))
+}
+
+func TestDo_MultipartBody_StreamFieldsAndFiles(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received [][]receivedPart
+	)
+	s := newMultipartServer(&mu, &received)
+	defer s.Close()
+
+	path := filepath.Join(t.TempDir(), "report.csv")
+	assert.Nil(t, os.WriteFile(path, []byte("a,b\n1,2\n"), 0o644))
+
+	cli := client.New(client.WithHost(s.URL))
+	form := client.NewMultipart().
+		Field("title", "monthly").
+		FilePath("report", path, client.WithPartContentType("text/csv")).
+		FileBytes("logo", `lo"go.png`, []byte("png"), client.WithPartHeader("X-Checksum", "abc")).
+		File("notes", "notes.txt", func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader("notes")), nil
+		})
+	res, err := cli.Do(ctx, cli.NewRequest().Method(http.MethodPost).MultipartBody(form))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, [][]receivedPart{{
+		{formName: "title", content: "monthly"},
+		{formName: "report", fileName: "report.csv", contentType: "text/csv", content: "a,b\n1,2\n"},
+		{formName: "logo", fileName: `lo"go.png`, contentType: "application/octet-stream", header: "abc", content: "png"},
+		{formName: "notes", fileName: "notes.txt", contentType: "application/octet-stream", content: "notes"},
+	}}, received)
+}
+
+func TestDo_MultipartBodyRetried_ReopenFilesOnEveryAttempt(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received [][]receivedPart
+	)
+	s := newMultipartServer(&mu, &received, 500, 200)
+	defer s.Close()
+
+	var opened int
+	cli := client.New(client.WithHost(s.URL), client.WithRetry(1, time.Millisecond))
+	form := client.NewMultipart().File("file", "a.txt", func() (io.ReadCloser, error) {
+		opened++
+		return io.NopCloser(strings.NewReader("content")), nil
+	})
+	res, err := cli.Do(ctx, cli.NewRequest().Method(http.MethodPut).MultipartBody(form))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, 2, opened)
+	assert.Len(t, received, 2)
+	assert.Equal(t, received[0], received[1])
+}
+
+func TestDo_MultipartBodyDeadLettered_SaveWholeBodyToLetter(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received [][]receivedPart
+	)
+	s := newMultipartServer(&mu, &received, 500)
+	defer s.Close()
+
+	var letter *client.Letter
+	mockDeadLetter := client.NewMockDeadLetter(gomock.NewController(t))
+	mockDeadLetter.EXPECT().Save(gomock.Any()).Do(func(l *client.Letter) { letter = l })
+
+	cli := client.New(client.WithHost(s.URL), client.WithDeadLetter(mockDeadLetter), client.WithRetry(0, time.Millisecond))
+	form := client.NewMultipart().FileBytes("file", "a.txt", []byte("content"))
+	_, err := cli.Do(ctx, cli.NewRequest().Method(http.MethodPut).MultipartBody(form))
+
+	assert.Nil(t, err)
+	assert.Equal(t, form.FormDataContentType(), letter.Headers["Content-Type"][0])
+	assert.Contains(t, string(letter.Body), "content")
+}
+
+func TestDo_MultipartBodyFromReader_DoNotRetryOrDeadLetter(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received [][]receivedPart
+	)
+	s := newMultipartServer(&mu, &received, 500, 500)
+	defer s.Close()
+
+	mockDeadLetter := client.NewMockDeadLetter(gomock.NewController(t))
+	cli := client.New(client.WithHost(s.URL), client.WithDeadLetter(mockDeadLetter), client.WithRetry(1, time.Millisecond))
+	form := client.NewMultipart().FileReader("file", "a.txt", strings.NewReader("content"))
+	res, err := cli.Do(ctx, cli.NewRequest().Method(http.MethodPut).MultipartBody(form))
+
+	assert.ErrorIs(t, err, client.ErrBodyNotRewindable)
+	assert.Equal(t, 500, res.StatusCode)
+	assert.Len(t, received, 1)
+}
@@ -18,20 +18,108 @@ func WithHost(host string) Option {
 }
 
 // WithRetry create client option function with retrying properties
+// the retry interval grows exponentially on every attempt
 func WithRetry(maxRetry int, retryInterval time.Duration) Option {
+	return WithRetryPolicy(NewExponentialRetryPolicy(maxRetry, retryInterval, _retryIntervalCoef))
+}
+
+// WithRetryPolicy create client option function with a custom retry policy
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retryPolicy = policy
+	}
+}
+
+// WithMaxRetryAfter create client option function with the longest duration
+// the client waits for when a response asks for it via the Retry-After header
+func WithMaxRetryAfter(maxRetryAfter time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetryAfter = maxRetryAfter
+	}
+}
+
+// WithRetryBudget create client option function with a retry budget shared by all requests of the client
+func WithRetryBudget(budget *RetryBudget) Option {
+	return func(c *Client) {
+		c.retryBudget = budget
+	}
+}
+
+// WithHedging create client option function with hedging properties
+// if an idempotent request has no response after the delay another copy of it is sent, up to maxHedges copies.
+// The first successful response is used and the other copies are cancelled
+func WithHedging(delay time.Duration, maxHedges int) Option {
 	return func(c *Client) {
-		c.maxRetry = maxRetry
-		c.retryInterval = retryInterval
+		c.hedging = &hedging{delay: delay, maxHedges: maxHedges}
+	}
+}
+
+// WithRetryHeader create client option function with the name of the header
+// that carries the retry number on retried attempts, an empty name disables the header
+func WithRetryHeader(name string) Option {
+	return func(c *Client) {
+		c.retryHeader = name
 	}
 }
 
 // WithDeadLetter create client option function with deadletter properties
 func WithDeadLetter(deadLetter DeadLetter) Option {
+	return WithDeadLetterV2(AdaptDeadLetter(deadLetter))
+}
+
+// WithDeadLetterV2 create client option function with a context aware deadletter
+func WithDeadLetterV2(deadLetter DeadLetterV2) Option {
 	return func(c *Client) {
 		c.deadLetter = deadLetter
 	}
 }
 
+// WithDeadLetterPredicate create client option function that decides which requests are saved to the deadletter
+func WithDeadLetterPredicate(predicate DeadLetterPredicate) Option {
+	return func(c *Client) {
+		c.saveLetterIf = predicate
+	}
+}
+
+// WithRedaction create client option function that masks sensitive data of letters before they are sent to the deadletter
+func WithRedaction(policy RedactionPolicy) Option {
+	return func(c *Client) {
+		c.redaction = &policy
+	}
+}
+
+// WithLetterEncryption create client option function that encrypts the body of letters before they are sent
+// to the deadletter. The key has to be 16, 24 or 32 bytes long and it is needed to decrypt the letters for replaying
+func WithLetterEncryption(key []byte) Option {
+	return func(c *Client) {
+		c.letterKey = key
+	}
+}
+
+// WithBodyEncoder create client option function that registers the body encoder with the given name,
+// so requests can use it with EncodedBody. The built in json, xml and form encoders can be replaced
+func WithBodyEncoder(encoding string, encoder BodyEncoder) Option {
+	return func(c *Client) {
+		c.bodyEncoders[encoding] = encoder
+	}
+}
+
+// WithSuccessStatusCodes create client option function with the status codes that Parse accepts as success,
+// every other status code is returned as an *HTTPError. Every 2XX status code is a success by default
+func WithSuccessStatusCodes(statusCodes ...int) Option {
+	return func(c *Client) {
+		c.successStatusCodes = statusCodes
+	}
+}
+
+// WithErrorType create client option function that decodes the body of non success responses into the error
+// created by the given function, such as func() error { return &ErrorMessage{} }. The decoded error is the Err of the *HTTPError
+func WithErrorType(newError func() error) Option {
+	return func(c *Client) {
+		c.newError = newError
+	}
+}
+
 // WithHTTPClient create client option function with http client
 func WithHTTPClient(httpClient *http.Client) Option {
 	return func(c *Client) {
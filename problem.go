@@ -0,0 +1,94 @@
+package client
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"mime"
+	"strings"
+)
+
+// ProblemContentType is the content type of the RFC 7807 problem details
+const ProblemContentType = "application/problem+json"
+
+// ProblemDetails is an RFC 7807 error response. Responses with the application/problem+json content type are decoded
+// into it when the request and the client do not have an error type
+type ProblemDetails struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Extensions are the members of the problem that are not defined by RFC 7807
+	Extensions map[string]interface{} `json:"-"`
+}
+
+func (p *ProblemDetails) Error() string {
+	message := p.Title
+	if message == "" {
+		message = p.Type
+	}
+	if p.Detail != "" {
+		message += ": " + p.Detail
+	}
+	return message
+}
+
+// UnmarshalJSON decodes the problem and keeps the extension members
+func (p *ProblemDetails) UnmarshalJSON(data []byte) error {
+	type problem ProblemDetails
+	if err := json.Unmarshal(data, (*problem)(p)); err != nil {
+		return err
+	}
+
+	var members map[string]interface{}
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+	for _, name := range []string{"type", "title", "status", "detail", "instance"} {
+		delete(members, name)
+	}
+	if len(members) > 0 {
+		p.Extensions = members
+	}
+	return nil
+}
+
+// errorTypeFor returns the function that creates the error type of the request, the request overrides the client
+func (c *Client) errorTypeFor(request *Request) func() error {
+	if request.newError != nil {
+		return request.newError
+	}
+	return c.newError
+}
+
+// decodeErrorBody decodes the body of the error response into the error type of the request.
+// If there is no error type, problem details are decoded. The body is decoded as xml if the response is xml,
+// otherwise as json. Nil is returned if the body can not be decoded
+func (c *Client) decodeErrorBody(request *Request, httpErr *HTTPError, body []byte) error {
+	if len(body) == 0 {
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(httpErr.Header.Get(_contentTypeHeader))
+
+	newError := c.errorTypeFor(request)
+	if newError == nil {
+		if mediaType != ProblemContentType {
+			return nil
+		}
+		newError = func() error { return &ProblemDetails{} }
+	}
+
+	target := newError()
+	if target == nil {
+		return nil
+	}
+	unmarshal := json.Unmarshal
+	if strings.HasSuffix(mediaType, "/xml") || strings.HasSuffix(mediaType, "+xml") {
+		unmarshal = xml.Unmarshal
+	}
+	if err := unmarshal(body, target); err != nil {
+		return nil
+	}
+	return target
+}
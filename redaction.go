@@ -0,0 +1,261 @@
+package client
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	urlpkg "net/url"
+	"strings"
+)
+
+const (
+	// RedactedValue replaces the masked header values, query parameters and json fields
+	RedactedValue = "[REDACTED]"
+
+	_letterEncryptionAlgorithm = "AES-256-GCM"
+	_dataKeySize               = 32
+)
+
+// ErrLetterEncrypted is returned when the body of an encrypted letter is used without decrypting it
+var ErrLetterEncrypted = errors.New("letter body is encrypted")
+
+// DefaultRedactedHeaders are the headers that usually carry credentials
+var DefaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// DefaultRedactedQueryParams are the query parameters that usually carry credentials
+var DefaultRedactedQueryParams = []string{"api_key", "apikey", "access_token", "token", "password"}
+
+// RedactionPolicy masks sensitive data of letters before they are sent to a deadletter
+type RedactionPolicy struct {
+	// Headers are the names of the headers whose values are masked
+	Headers []string
+	// QueryParams are the names of the url query parameters whose values are masked, names are case insensitive
+	QueryParams []string
+	// JSONFields are dot separated paths of the json fields that are masked in the request and the response body,
+	// such as "card.number". A path that goes through an array is applied to every element of the array.
+	// A body that can not be parsed as json, for example because it is cut off, is replaced with RedactedValue
+	JSONFields []string
+	// Redactor is called with every letter after the headers, the query parameters and the json fields are masked
+	Redactor func(letter *Letter)
+}
+
+// LetterEncryption describes how the body of a letter is encrypted
+type LetterEncryption struct {
+	Algorithm string `json:"algorithm"`
+	// EncryptedKey is the key of the body encrypted with the key given by the user
+	EncryptedKey []byte `json:"encryptedKey"`
+	// ResponseBodyEncrypted is set if the response body is encrypted with the same key as the body
+	ResponseBodyEncrypted bool `json:"responseBodyEncrypted,omitempty"`
+}
+
+// apply masks the letter, the headers of the letter are copied before they are changed
+func (p *RedactionPolicy) apply(letter *Letter) {
+	if len(p.Headers) > 0 && len(letter.Headers) > 0 {
+		headers := http.Header(letter.Headers).Clone()
+		for _, name := range p.Headers {
+			if values := headers.Values(name); len(values) > 0 {
+				masked := make([]string, len(values))
+				for i := range masked {
+					masked[i] = RedactedValue
+				}
+				headers[http.CanonicalHeaderKey(name)] = masked
+			}
+		}
+		letter.Headers = headers
+	}
+
+	letter.URL = p.redactURL(letter.URL)
+
+	if len(p.JSONFields) > 0 {
+		letter.Body = redactJSONFields(letter.Body, p.JSONFields)
+		letter.ResponseBody = redactJSONFields(letter.ResponseBody, p.JSONFields)
+	}
+
+	if p.Redactor != nil {
+		p.Redactor(letter)
+	}
+}
+
+// redactURL masks the query parameters of the policy in the url
+func (p *RedactionPolicy) redactURL(url string) string {
+	if len(p.QueryParams) == 0 {
+		return url
+	}
+	return redactQueryParams(url, p.QueryParams)
+}
+
+// redactQueryParams masks the values of the given query parameters, urls that could not be parsed are returned as they are
+func redactQueryParams(rawURL string, names []string) string {
+	u, err := urlpkg.Parse(rawURL)
+	if err != nil || u.RawQuery == "" {
+		return rawURL
+	}
+
+	query := u.Query()
+	redacted := false
+	for key, values := range query {
+		for _, name := range names {
+			if strings.EqualFold(key, name) {
+				for i := range values {
+					values[i] = RedactedValue
+				}
+				redacted = true
+				break
+			}
+		}
+	}
+	if !redacted {
+		return rawURL
+	}
+
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// redactJSONFields masks the fields in the given paths. Bodies that are not a single json document, such as a cut off body,
+// are replaced with RedactedValue as a whole, because it can not be known what they contain
+func redactJSONFields(body []byte, paths []string) []byte {
+	if len(body) == 0 {
+		return body
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return []byte(RedactedValue)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return []byte(RedactedValue)
+	}
+
+	for _, path := range paths {
+		redactJSONPath(document, strings.Split(path, "."))
+	}
+
+	redacted, err := json.Marshal(document)
+	if err != nil {
+		return []byte(RedactedValue)
+	}
+	return redacted
+}
+
+func redactJSONPath(node interface{}, path []string) {
+	switch value := node.(type) {
+	case []interface{}:
+		for _, element := range value {
+			redactJSONPath(element, path)
+		}
+	case map[string]interface{}:
+		child, ok := value[path[0]]
+		if !ok {
+			return
+		}
+		if len(path) == 1 {
+			value[path[0]] = RedactedValue
+			return
+		}
+		redactJSONPath(child, path[1:])
+	}
+}
+
+// EncryptLetter encrypts the body and the response body of the letter with a new random key, and encrypts that key with the given key.
+// The key has to be 16, 24 or 32 bytes long
+func EncryptLetter(letter *Letter, key []byte) error {
+	dataKey := make([]byte, _dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return err
+	}
+
+	body, err := seal(dataKey, letter.Body)
+	if err != nil {
+		return err
+	}
+	var responseBody []byte
+	if len(letter.ResponseBody) > 0 {
+		if responseBody, err = seal(dataKey, letter.ResponseBody); err != nil {
+			return err
+		}
+	}
+	encryptedKey, err := seal(key, dataKey)
+	if err != nil {
+		return err
+	}
+
+	letter.Body = body
+	letter.ResponseBody = responseBody
+	letter.Encryption = &LetterEncryption{
+		Algorithm:             _letterEncryptionAlgorithm,
+		EncryptedKey:          encryptedKey,
+		ResponseBodyEncrypted: responseBody != nil,
+	}
+	return nil
+}
+
+// DecryptLetter decrypts the body and the response body of a letter that is encrypted by EncryptLetter with the same key.
+// Letters that are not encrypted are left as they are
+func DecryptLetter(letter *Letter, key []byte) error {
+	if letter.Encryption == nil {
+		return nil
+	}
+
+	dataKey, err := open(key, letter.Encryption.EncryptedKey)
+	if err != nil {
+		return err
+	}
+	body, err := open(dataKey, letter.Body)
+	if err != nil {
+		return err
+	}
+	if letter.Encryption.ResponseBodyEncrypted {
+		if letter.ResponseBody, err = open(dataKey, letter.ResponseBody); err != nil {
+			return err
+		}
+	}
+
+	letter.Body = body
+	letter.Encryption = nil
+	return nil
+}
+
+// seal encrypts the plaintext with aes gcm and puts the nonce in front of the ciphertext
+func seal(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// open decrypts a ciphertext created by seal
+func open(key, ciphertext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	nonce, ciphertext := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,183 @@
+package client_test
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bilginyuksel/client"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDo_WithRedaction_MaskHeadersAndJSONFieldsOfLetter(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(500)
+	}))
+
+	var letter *client.Letter
+	mockDeadLetter := client.NewMockDeadLetter(gomock.NewController(t))
+	mockDeadLetter.EXPECT().Save(gomock.Any()).Do(func(l *client.Letter) { letter = l })
+
+	cli := client.New(client.WithHost(s.URL), client.WithDeadLetter(mockDeadLetter), client.WithRetry(0, time.Millisecond),
+		client.WithRedaction(client.RedactionPolicy{
+			Headers:    client.DefaultRedactedHeaders,
+			JSONFields: []string{"card.number", "items.secret", "missing.field"},
+			Redactor: func(l *client.Letter) {
+				l.Tags = map[string]string{"redacted": "true"}
+			},
+		}))
+	request := cli.NewRequest().
+		Body([]byte(`{"amount":10.50,"card":{"number":"4111111111111111","holder":"john"},"items":[{"secret":"a"},{"secret":"b"}]}`)).
+		SetHeader("Authorization", "Bearer token").
+		SetHeader("X-Request-Id", "123")
+	_, err := cli.Do(ctx, request)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{client.RedactedValue}, letter.Headers["Authorization"])
+	assert.Equal(t, []string{"123"}, letter.Headers["X-Request-Id"])
+	assert.JSONEq(t, `{"amount":10.50,"card":{"number":"[REDACTED]","holder":"john"},"items":[{"secret":"[REDACTED]"},{"secret":"[REDACTED]"}]}`, string(letter.Body))
+	assert.Equal(t, map[string]string{"redacted": "true"}, letter.Tags)
+}
+
+func TestDo_WithRedactionNonJSONBody_ReplaceBody(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(500)
+	}))
+
+	var letter *client.Letter
+	mockDeadLetter := client.NewMockDeadLetter(gomock.NewController(t))
+	mockDeadLetter.EXPECT().Save(gomock.Any()).Do(func(l *client.Letter) { letter = l })
+
+	cli := client.New(client.WithHost(s.URL), client.WithDeadLetter(mockDeadLetter), client.WithRetry(0, time.Millisecond),
+		client.WithRedaction(client.RedactionPolicy{JSONFields: []string{"password"}}))
+	_, _ = cli.Do(ctx, cli.NewRequest().Body([]byte("password=secret")))
+
+	assert.Equal(t, []byte(client.RedactedValue), letter.Body)
+}
+
+func TestDo_WithRedactionCutOffResponseBody_ReplaceResponseBody(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(500)
+		_, _ = rw.Write([]byte(`{"email":"secret@pii.com","padding":"` + strings.Repeat("a", 5000) + `"}`))
+	}))
+
+	var letter *client.Letter
+	mockDeadLetter := client.NewMockDeadLetter(gomock.NewController(t))
+	mockDeadLetter.EXPECT().Save(gomock.Any()).Do(func(l *client.Letter) { letter = l })
+
+	cli := client.New(client.WithHost(s.URL), client.WithDeadLetter(mockDeadLetter), client.WithRetry(0, time.Millisecond),
+		client.WithRedaction(client.RedactionPolicy{JSONFields: []string{"email"}}))
+	_, _ = cli.Do(ctx, cli.NewRequest())
+
+	assert.Equal(t, []byte(client.RedactedValue), letter.ResponseBody)
+}
+
+func TestDo_WithRedactionDeadLetterErr_LogOnlyMethodAndRedactedURL(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(500)
+	}))
+
+	var output bytes.Buffer
+	log.SetOutput(&output)
+	defer log.SetOutput(os.Stderr)
+
+	mockDeadLetter := client.NewMockDeadLetter(gomock.NewController(t))
+	mockDeadLetter.EXPECT().Save(gomock.Any()).Return(errors.New("unavailable"))
+
+	cli := client.New(client.WithHost(s.URL), client.WithDeadLetter(mockDeadLetter), client.WithRetry(0, time.Millisecond),
+		client.WithRedaction(client.RedactionPolicy{Headers: client.DefaultRedactedHeaders, QueryParams: client.DefaultRedactedQueryParams}))
+	request := cli.NewRequest().
+		Path("/orders").
+		AddQuery("token", "query-secret").
+		SetHeader("Authorization", "Bearer header-secret").
+		Body([]byte(`{"card":"body-secret"}`))
+	_, err := cli.Do(ctx, request)
+
+	assert.NotNil(t, err)
+	assert.Contains(t, output.String(), "method: GET, url: "+s.URL+"/orders?token=%5BREDACTED%5D")
+	assert.NotContains(t, output.String(), "secret")
+}
+
+func TestDo_WithRedaction_MaskQueryParamsAndResponseBodyOfLetter(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(500)
+		_, _ = rw.Write([]byte(`{"error":"failed","card":{"number":"4111111111111111"}}`))
+	}))
+
+	var letter *client.Letter
+	mockDeadLetter := client.NewMockDeadLetter(gomock.NewController(t))
+	mockDeadLetter.EXPECT().Save(gomock.Any()).Do(func(l *client.Letter) { letter = l })
+
+	cli := client.New(client.WithHost(s.URL), client.WithDeadLetter(mockDeadLetter), client.WithRetry(0, time.Millisecond),
+		client.WithRedaction(client.RedactionPolicy{
+			QueryParams: client.DefaultRedactedQueryParams,
+			JSONFields:  []string{"card.number"},
+		}))
+	_, err := cli.Do(ctx, cli.NewRequest().Path("/orders").AddQuery("API_KEY", "secret").AddQuery("page", "2"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, s.URL+"/orders?API_KEY=%5BREDACTED%5D&page=2", letter.URL)
+	assert.JSONEq(t, `{"error":"failed","card":{"number":"[REDACTED]"}}`, string(letter.ResponseBody))
+}
+
+func TestEncryptLetter_WithResponseBody_EncryptAndDecryptResponseBody(t *testing.T) {
+	key := bytes.Repeat([]byte("k"), 32)
+	letter := &client.Letter{Body: []byte("secret body"), ResponseBody: []byte("secret response")}
+
+	assert.Nil(t, client.EncryptLetter(letter, key))
+	assert.True(t, letter.Encryption.ResponseBodyEncrypted)
+	assert.NotContains(t, string(letter.ResponseBody), "secret response")
+
+	assert.Nil(t, client.DecryptLetter(letter, key))
+	assert.Equal(t, []byte("secret body"), letter.Body)
+	assert.Equal(t, []byte("secret response"), letter.ResponseBody)
+}
+
+func TestEncryptLetter_DecryptWithSameKey_ReturnOriginalBody(t *testing.T) {
+	key := bytes.Repeat([]byte("k"), 32)
+	letter := &client.Letter{Body: []byte("secret body")}
+
+	assert.Nil(t, client.EncryptLetter(letter, key))
+	assert.NotNil(t, letter.Encryption)
+	assert.NotContains(t, string(letter.Body), "secret body")
+
+	assert.NotNil(t, client.DecryptLetter(&client.Letter{Body: letter.Body, Encryption: letter.Encryption}, bytes.Repeat([]byte("x"), 32)))
+
+	assert.Nil(t, client.DecryptLetter(letter, key))
+	assert.Nil(t, letter.Encryption)
+	assert.Equal(t, []byte("secret body"), letter.Body)
+}
+
+func TestReplayer_EncryptedLetters_DecryptWithReplayKey(t *testing.T) {
+	key := bytes.Repeat([]byte("k"), 32)
+	var (
+		mu       sync.Mutex
+		captured []capturedRequest
+	)
+	s := newReplayServer(&captured, &mu)
+
+	letter := &client.Letter{Method: http.MethodPost, URL: s.URL + "/orders", Body: []byte("secret body")}
+	assert.Nil(t, client.EncryptLetter(letter, key))
+	deadLetter := newFileDeadLetterWithLetters(t, letter)
+	defer deadLetter.Close()
+
+	cli := client.New(client.WithRetry(0, time.Millisecond))
+	results, err := client.NewReplayer(cli, deadLetter).Replay(ctx)
+	assert.Nil(t, err)
+	assert.ErrorIs(t, results[0].Err, client.ErrLetterEncrypted)
+
+	results, err = client.NewReplayer(cli, deadLetter, client.WithReplayDecryption(key), client.WithReplayRemoveSucceeded()).Replay(ctx)
+	assert.Nil(t, err)
+	assert.True(t, results[0].Succeeded())
+	assert.True(t, results[0].Removed)
+	assert.Len(t, captured, 1)
+	assert.Equal(t, "secret body", captured[0].body)
+}
@@ -0,0 +1,261 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	urlpkg "net/url"
+)
+
+// LetterSource provides stored letters to a replayer
+type LetterSource interface {
+	// Walk calls the given function for every stored letter and stops at the first error
+	Walk(fn func(letter *Letter) error) error
+}
+
+// LetterRemover is implemented by letter sources that can delete letters after they are replayed
+type LetterRemover interface {
+	Remove(letters ...*Letter) error
+}
+
+// ReplayResult is the outcome of replaying a single letter
+type ReplayResult struct {
+	Letter *Letter
+	// StatusCode is the status code of the replayed request, zero if there is no response
+	StatusCode int
+	// Err is the error of the replayed request
+	Err error
+	// DryRun is true if the letter is not sent because the replayer runs in dry run mode
+	DryRun bool
+	// Removed is true if the letter is deleted from the source after it is replayed successfully
+	Removed bool
+}
+
+// Succeeded reports whether the letter is sent and answered with a 2XX status code
+func (r ReplayResult) Succeeded() bool {
+	return !r.DryRun && r.Err == nil && r.StatusCode >= 200 && r.StatusCode <= 299
+}
+
+// Replayer sends stored letters again through a client, so the rate limiter and the retries of the client are used.
+// Replayed requests are never sent to a deadletter again
+type Replayer struct {
+	client          *Client
+	source          LetterSource
+	dryRun          bool
+	removeSucceeded bool
+	decryptionKey   []byte
+	host            string
+	filters         []func(letter *Letter) bool
+}
+
+// ReplayOption is a function that configures a replayer
+type ReplayOption func(r *Replayer)
+
+// WithReplayDryRun create replay option function that reports the matching letters without sending them
+func WithReplayDryRun() ReplayOption {
+	return func(r *Replayer) {
+		r.dryRun = true
+	}
+}
+
+// WithReplayRemoveSucceeded create replay option function that deletes the successfully replayed letters
+// from the source, the source has to implement LetterRemover
+func WithReplayRemoveSucceeded() ReplayOption {
+	return func(r *Replayer) {
+		r.removeSucceeded = true
+	}
+}
+
+// WithReplayDecryption create replay option function with the key that decrypts the letters encrypted by WithLetterEncryption
+func WithReplayDecryption(key []byte) ReplayOption {
+	return func(r *Replayer) {
+		r.decryptionKey = key
+	}
+}
+
+// WithReplayHost create replay option function that sends the letters to the given host instead of their own host,
+// such as "http://localhost:8080"
+func WithReplayHost(host string) ReplayOption {
+	return func(r *Replayer) {
+		r.host = host
+	}
+}
+
+// WithReplayFilter create replay option function that only replays the letters the filter accepts
+func WithReplayFilter(filter func(letter *Letter) bool) ReplayOption {
+	return func(r *Replayer) {
+		r.filters = append(r.filters, filter)
+	}
+}
+
+// WithReplayMethods create replay option function that only replays the letters with one of the given methods
+func WithReplayMethods(methods ...string) ReplayOption {
+	return WithReplayFilter(func(letter *Letter) bool {
+		for _, method := range methods {
+			if strings.EqualFold(letter.Method, method) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// WithReplayURLPrefix create replay option function that only replays the letters whose url starts with the prefix
+func WithReplayURLPrefix(prefix string) ReplayOption {
+	return WithReplayFilter(func(letter *Letter) bool {
+		return strings.HasPrefix(letter.URL, prefix)
+	})
+}
+
+// WithReplayTimeRange create replay option function that only replays the letters created in the given range,
+// a zero since or until leaves that side of the range open
+func WithReplayTimeRange(since, until time.Time) ReplayOption {
+	return WithReplayFilter(func(letter *Letter) bool {
+		if !since.IsZero() && letter.CreatedAt.Before(since) {
+			return false
+		}
+		return until.IsZero() || letter.CreatedAt.Before(until)
+	})
+}
+
+// NewReplayer create a replayer that sends the letters of the source through the given client
+func NewReplayer(client *Client, source LetterSource, opts ...ReplayOption) *Replayer {
+	r := &Replayer{
+		client: client,
+		source: source,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Replay sends every matching letter once and reports the outcome of each.
+// If the context is done replaying stops, the letters that already succeeded are still removed
+// and the results so far are returned with the context error
+func (r *Replayer) Replay(ctx context.Context) ([]ReplayResult, error) {
+	var letters []*Letter
+	err := r.source.Walk(func(letter *Letter) error {
+		if r.matches(letter) {
+			letters = append(letters, letter)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ReplayResult, 0, len(letters))
+	for _, letter := range letters {
+		if err := ctx.Err(); err != nil {
+			if removeErr := r.remove(results); removeErr != nil {
+				return results, removeErr
+			}
+			return results, err
+		}
+		results = append(results, r.replay(ctx, letter))
+	}
+
+	return results, r.remove(results)
+}
+
+func (r *Replayer) replay(ctx context.Context, letter *Letter) ReplayResult {
+	result := ReplayResult{Letter: letter, DryRun: r.dryRun}
+	if r.dryRun {
+		return result
+	}
+
+	if letter.Encryption != nil && r.decryptionKey != nil {
+		decrypted := *letter
+		if err := DecryptLetter(&decrypted, r.decryptionKey); err != nil {
+			result.Err = err
+			return result
+		}
+		letter = &decrypted
+	}
+
+	request, err := r.client.NewRequestFromLetter(letter)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if r.host != "" {
+		request.Host(r.host)
+	}
+
+	res, err := r.client.Do(ctx, request.SkipDeadLetter())
+	result.StatusCode = statusCode(res)
+	result.Err = err
+	closeResponse(res)
+	return result
+}
+
+func (r *Replayer) remove(results []ReplayResult) error {
+	remover, ok := r.source.(LetterRemover)
+	if !r.removeSucceeded || !ok {
+		return nil
+	}
+
+	var succeeded []*Letter
+	for _, result := range results {
+		if result.Succeeded() {
+			succeeded = append(succeeded, result.Letter)
+		}
+	}
+	if len(succeeded) == 0 {
+		return nil
+	}
+
+	if err := remover.Remove(succeeded...); err != nil {
+		return err
+	}
+	for i := range results {
+		results[i].Removed = results[i].Succeeded()
+	}
+	return nil
+}
+
+func (r *Replayer) matches(letter *Letter) bool {
+	for _, filter := range r.filters {
+		if !filter(letter) {
+			return false
+		}
+	}
+	return true
+}
+
+// NewRequestFromLetter rebuilds the request that is saved as the given letter.
+// If the letter has an Idempotency-Key header the request is retried with the same key.
+// Encrypted letters have to be decrypted with DecryptLetter first and letters with a truncated body can not be rebuilt
+func (c *Client) NewRequestFromLetter(letter *Letter) (*Request, error) {
+	if letter.Encryption != nil {
+		return nil, ErrLetterEncrypted
+	}
+	if letter.BodyTruncated {
+		return nil, ErrLetterBodyTruncated
+	}
+
+	url, err := urlpkg.Parse(letter.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	request := c.NewRequest().
+		Method(letter.Method).
+		Body(letter.Body)
+	request.host = (&urlpkg.URL{Scheme: url.Scheme, User: url.User, Host: url.Host}).String()
+	request.path = url.EscapedPath()
+	request.query = url.Query()
+	if letter.Headers != nil {
+		request.headers = http.Header(letter.Headers).Clone()
+	}
+	if key := request.headers.Get(_idempotencyKeyHeader); key != "" {
+		request.IdempotencyKey(key)
+	}
+
+	return request, nil
+}
@@ -0,0 +1,195 @@
+package client_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bilginyuksel/client"
+	"github.com/stretchr/testify/assert"
+)
+
+type capturedRequest struct {
+	method string
+	uri    string
+	body   string
+	header http.Header
+}
+
+func newReplayServer(captured *[]capturedRequest, mu *sync.Mutex) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		*captured = append(*captured, capturedRequest{method: r.Method, uri: r.URL.RequestURI(), body: string(body), header: r.Header})
+		mu.Unlock()
+		if r.URL.Path == "/fail" {
+			rw.WriteHeader(400)
+		}
+	}))
+}
+
+func newFileDeadLetterWithLetters(t *testing.T, letters ...*client.Letter) *client.FileDeadLetter {
+	deadLetter, err := client.NewFileDeadLetter(filepath.Join(t.TempDir(), "letters.jsonl"))
+	assert.Nil(t, err)
+	for _, letter := range letters {
+		assert.Nil(t, deadLetter.Save(letter))
+	}
+	return deadLetter
+}
+
+func TestReplayer_Replay_SendEveryLetter(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		captured []capturedRequest
+	)
+	s := newReplayServer(&captured, &mu)
+	deadLetter := newFileDeadLetterWithLetters(t,
+		&client.Letter{Method: http.MethodPost, URL: s.URL + "/orders/1?customerId=12&x=a%20b", Body: []byte("hello"), Headers: map[string][]string{"X-R": {"req"}}},
+		&client.Letter{Method: http.MethodGet, URL: s.URL + "/fail"},
+	)
+	defer deadLetter.Close()
+
+	cli := client.New(client.WithRetry(0, time.Millisecond))
+	results, err := client.NewReplayer(cli, deadLetter).Replay(ctx)
+
+	assert.Nil(t, err)
+	assert.Len(t, results, 2)
+	assert.True(t, results[0].Succeeded())
+	assert.False(t, results[1].Succeeded())
+	assert.Equal(t, 400, results[1].StatusCode)
+
+	assert.Len(t, captured, 2)
+	assert.Equal(t, http.MethodPost, captured[0].method)
+	assert.Equal(t, "/orders/1?customerId=12&x=a+b", captured[0].uri)
+	assert.Equal(t, "hello", captured[0].body)
+	assert.Equal(t, "req", captured[0].header.Get("X-R"))
+}
+
+func TestReplayer_DryRun_DoNotSendLetters(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		captured []capturedRequest
+	)
+	s := newReplayServer(&captured, &mu)
+	deadLetter := newFileDeadLetterWithLetters(t, &client.Letter{Method: http.MethodGet, URL: s.URL + "/orders"})
+	defer deadLetter.Close()
+
+	results, err := client.NewReplayer(client.New(), deadLetter, client.WithReplayDryRun()).Replay(ctx)
+
+	assert.Nil(t, err)
+	assert.Len(t, results, 1)
+	assert.True(t, results[0].DryRun)
+	assert.Empty(t, captured)
+}
+
+func TestReplayer_Filters_ReplayOnlyMatchingLetters(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		captured []capturedRequest
+	)
+	s := newReplayServer(&captured, &mu)
+	now := time.Now()
+	deadLetter := newFileDeadLetterWithLetters(t,
+		&client.Letter{Method: http.MethodGet, URL: s.URL + "/orders/1", CreatedAt: now.Add(-2 * time.Hour)},
+		&client.Letter{Method: http.MethodGet, URL: s.URL + "/orders/2", CreatedAt: now},
+		&client.Letter{Method: http.MethodPost, URL: s.URL + "/orders/3", CreatedAt: now},
+		&client.Letter{Method: http.MethodGet, URL: s.URL + "/payments/4", CreatedAt: now},
+	)
+	defer deadLetter.Close()
+
+	results, err := client.NewReplayer(client.New(), deadLetter,
+		client.WithReplayMethods(http.MethodGet),
+		client.WithReplayURLPrefix(s.URL+"/orders"),
+		client.WithReplayTimeRange(now.Add(-time.Hour), time.Time{}),
+	).Replay(ctx)
+
+	assert.Nil(t, err)
+	assert.Len(t, results, 1)
+	assert.Equal(t, s.URL+"/orders/2", results[0].Letter.URL)
+	assert.Len(t, captured, 1)
+}
+
+func TestReplayer_RemoveSucceeded_KeepOnlyFailedLetters(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		captured []capturedRequest
+	)
+	s := newReplayServer(&captured, &mu)
+	deadLetter := newFileDeadLetterWithLetters(t,
+		&client.Letter{Method: http.MethodGet, URL: s.URL + "/orders"},
+		&client.Letter{Method: http.MethodGet, URL: s.URL + "/fail"},
+		&client.Letter{Method: http.MethodGet, URL: s.URL + "/orders"},
+	)
+	defer deadLetter.Close()
+
+	results, err := client.NewReplayer(client.New(), deadLetter, client.WithReplayRemoveSucceeded()).Replay(ctx)
+
+	assert.Nil(t, err)
+	assert.True(t, results[0].Removed)
+	assert.False(t, results[1].Removed)
+	assert.True(t, results[2].Removed)
+
+	remaining := collectLetters(t, deadLetter)
+	assert.Len(t, remaining, 1)
+	assert.Equal(t, s.URL+"/fail", remaining[0].URL)
+
+	assert.Nil(t, deadLetter.Save(&client.Letter{Method: http.MethodGet, URL: s.URL + "/orders"}))
+	assert.Len(t, collectLetters(t, deadLetter), 2)
+}
+
+func TestReplayer_RemoveSucceededCancelledMidRun_RemoveAlreadySucceededLetters(t *testing.T) {
+	replayCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var count int32
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) == 2 {
+			cancel()
+			<-r.Context().Done()
+		}
+	}))
+	defer s.Close()
+
+	deadLetter := newFileDeadLetterWithLetters(t,
+		&client.Letter{Method: http.MethodGet, URL: s.URL + "/1"},
+		&client.Letter{Method: http.MethodGet, URL: s.URL + "/2"},
+		&client.Letter{Method: http.MethodGet, URL: s.URL + "/3"},
+		&client.Letter{Method: http.MethodGet, URL: s.URL + "/4"},
+	)
+	defer deadLetter.Close()
+
+	cli := client.New(client.WithRetry(0, time.Millisecond))
+	results, err := client.NewReplayer(cli, deadLetter, client.WithReplayRemoveSucceeded()).Replay(replayCtx)
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Len(t, results, 2)
+	assert.True(t, results[0].Removed)
+	assert.False(t, results[1].Removed)
+
+	remaining := collectLetters(t, deadLetter)
+	assert.Len(t, remaining, 3)
+	assert.Equal(t, s.URL+"/2", remaining[0].URL)
+}
+
+func TestReplayer_WithReplayHost_SendToGivenHost(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		captured []capturedRequest
+	)
+	s := newReplayServer(&captured, &mu)
+	deadLetter := newFileDeadLetterWithLetters(t, &client.Letter{Method: http.MethodGet, URL: "http://unreachable.invalid/orders/1?x=1"})
+	defer deadLetter.Close()
+
+	results, err := client.NewReplayer(client.New(), deadLetter, client.WithReplayHost(s.URL)).Replay(ctx)
+
+	assert.Nil(t, err)
+	assert.True(t, results[0].Succeeded())
+	assert.Len(t, captured, 1)
+	assert.Equal(t, "/orders/1?x=1", captured[0].uri)
+}
@@ -1,12 +1,21 @@
 package client
 
 import (
+	"context"
+	"crypto/rand"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	urlpkg "net/url"
 )
 
+const _idempotencyKeyHeader = "Idempotency-Key"
+
 // Request use this request struct to send http requests
 type Request struct {
 	method  string
@@ -15,6 +24,29 @@ type Request struct {
 	body    []byte
 	query   map[string][]string
 	headers http.Header
+	tags    map[string]string
+
+	// bodyValue is encoded with the encoder named bodyEncoding when the request is sent
+	bodyValue    interface{}
+	bodyEncoding string
+
+	// bodyFactory opens a streamed body for every attempt, bodyOnce is set if it can only be opened once
+	bodyFactory     func() (io.ReadCloser, error)
+	bodyContentType string
+	bodyOnce        bool
+
+	idempotent     bool
+	idempotencyKey string
+
+	retryPolicy    RetryPolicy
+	timeout        time.Duration
+	deadLetter     DeadLetterV2
+	skipDeadLetter bool
+	hedging        *hedging
+	newError       func() error
+
+	// attempts is only set on snapshots and shared by the hedged copies of the snapshot
+	attempts *attemptTracker
 
 	manipulators []func(r *http.Request)
 }
@@ -37,10 +69,74 @@ func (r *Request) Host(host string) *Request {
 
 // Body set the body of the request
 func (r *Request) Body(body []byte) *Request {
+	r.resetBody()
 	r.body = body
 	return r
 }
 
+// JSONBody set the body of the request to the json of the given value, the value is marshaled when the request is sent
+func (r *Request) JSONBody(v interface{}) *Request {
+	return r.EncodedBody(BodyEncodingJSON, v)
+}
+
+// XMLBody set the body of the request to the xml of the given value, the value is marshaled when the request is sent
+func (r *Request) XMLBody(v interface{}) *Request {
+	return r.EncodedBody(BodyEncodingXML, v)
+}
+
+// FormBody set the body of the request to the url encoded form of the given values
+func (r *Request) FormBody(values urlpkg.Values) *Request {
+	return r.EncodedBody(BodyEncodingForm, values)
+}
+
+// EncodedBody set the body of the request to the given value encoded by the body encoder registered with the name.
+// The value is encoded when the request is sent and encoding errors are returned by Client.Do
+func (r *Request) EncodedBody(encoding string, v interface{}) *Request {
+	r.resetBody()
+	r.bodyValue = v
+	r.bodyEncoding = encoding
+	return r
+}
+
+// BodyReader set the body of the request to the reader opened by the given function, the body is streamed
+// instead of being loaded into the memory. The function is called again for every retry, so it has to return
+// a new reader from the beginning of the body every time. The Content-Length header is sent if the reader
+// is a file or has a Len method, otherwise the body is sent in chunks
+func (r *Request) BodyReader(open func() (io.ReadCloser, error)) *Request {
+	r.resetBody()
+	r.bodyFactory = open
+	return r
+}
+
+// BodyStream set the body of the request to the given reader. The reader can only be read once,
+// so the request is never retried and saving it to a deadletter fails with ErrBodyNotRewindable
+func (r *Request) BodyStream(body io.Reader) *Request {
+	r.resetBody()
+	r.bodyFactory = openOnce(body)
+	r.bodyOnce = true
+	return r
+}
+
+// MultipartBody set the body of the request to the given multipart form, the Content-Type header is set with its boundary.
+// The parts are streamed when the request is sent, parts added to the multipart later are not sent
+func (r *Request) MultipartBody(m *Multipart) *Request {
+	m = m.clone()
+	r.resetBody()
+	r.bodyFactory = m.open
+	r.bodyContentType = m.FormDataContentType()
+	r.bodyOnce = m.once
+	return r
+}
+
+func (r *Request) resetBody() {
+	r.body = nil
+	r.bodyValue = nil
+	r.bodyEncoding = ""
+	r.bodyFactory = nil
+	r.bodyContentType = ""
+	r.bodyOnce = false
+}
+
 // Method set a method to given request
 func (r *Request) Method(method string) *Request {
 	r.method = method
@@ -92,6 +188,81 @@ func (r *Request) SetBasicAuth(username, password string) *Request {
 	return r
 }
 
+// Tag adds a tag to the request, tags are carried into the letter if the request is dead-lettered
+func (r *Request) Tag(key, value string) *Request {
+	if r.tags == nil {
+		r.tags = make(map[string]string)
+	}
+	r.tags[key] = value
+	return r
+}
+
+// Idempotent marks the request as safe to retry even if its method is not idempotent.
+// If the request has no Idempotency-Key header a new one is generated for every send and it stays the same across all attempts
+func (r *Request) Idempotent() *Request {
+	r.idempotent = true
+	return r
+}
+
+// IdempotencyKey marks the request as safe to retry and uses the given key as the Idempotency-Key header
+func (r *Request) IdempotencyKey(key string) *Request {
+	r.idempotent = true
+	r.idempotencyKey = key
+	return r
+}
+
+// Retry overrides the retrying properties of the client for this request
+// the retry interval grows exponentially on every attempt
+func (r *Request) Retry(maxRetry int, retryInterval time.Duration) *Request {
+	return r.RetryPolicy(NewExponentialRetryPolicy(maxRetry, retryInterval, _retryIntervalCoef))
+}
+
+// RetryPolicy overrides the retry policy of the client for this request
+func (r *Request) RetryPolicy(policy RetryPolicy) *Request {
+	r.retryPolicy = policy
+	return r
+}
+
+// Timeout sets a timeout for every single attempt of the request
+// timed out attempts are retried as long as the context of the request is not done
+func (r *Request) Timeout(timeout time.Duration) *Request {
+	r.timeout = timeout
+	return r
+}
+
+// DeadLetter overrides the deadletter of the client for this request
+func (r *Request) DeadLetter(deadLetter DeadLetter) *Request {
+	return r.DeadLetterV2(AdaptDeadLetter(deadLetter))
+}
+
+// DeadLetterV2 overrides the deadletter of the client for this request with a context aware deadletter
+func (r *Request) DeadLetterV2(deadLetter DeadLetterV2) *Request {
+	r.deadLetter = deadLetter
+	r.skipDeadLetter = false
+	return r
+}
+
+// SkipDeadLetter never sends the request to a deadletter even if it fails
+func (r *Request) SkipDeadLetter() *Request {
+	r.skipDeadLetter = true
+	return r
+}
+
+// Hedge overrides the hedging properties of the client for this request
+// if there is no response after the delay another copy of the request is sent, up to maxHedges copies.
+// Only idempotent requests are hedged, zero maxHedges disables hedging
+func (r *Request) Hedge(delay time.Duration, maxHedges int) *Request {
+	r.hedging = &hedging{delay: delay, maxHedges: maxHedges}
+	return r
+}
+
+// ErrorType overrides the error type of the client for this request,
+// the body of a non success response is decoded into the error created by the given function
+func (r *Request) ErrorType(newError func() error) *Request {
+	r.newError = newError
+	return r
+}
+
 // URL returns the url of the request
 func (r *Request) URL() (string, error) {
 	rawpath := fmt.Sprintf("%s%s", r.host, r.path)
@@ -113,3 +284,172 @@ func (r *Request) getEncodedQueryParameters() string {
 	}
 	return queryBuilder.Encode()
 }
+
+// retryable reports whether the request can be sent more than once without side effects
+func (r *Request) retryable() bool {
+	if r.bodyOnce {
+		return false
+	}
+	if r.idempotent {
+		return true
+	}
+
+	switch r.method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// openBody opens the streamed body for a single attempt
+func (r *Request) openBody() (io.ReadCloser, error) {
+	body, err := r.bodyFactory()
+	if err != nil {
+		return nil, fmt.Errorf("request body could not opened: %w", err)
+	}
+	return body, nil
+}
+
+// openOnce returns a function that opens the reader the first time and returns ErrBodyNotRewindable after that
+func openOnce(r io.Reader) func() (io.ReadCloser, error) {
+	var opened int32
+	return func() (io.ReadCloser, error) {
+		if !atomic.CompareAndSwapInt32(&opened, 0, 1) {
+			return nil, ErrBodyNotRewindable
+		}
+		if rc, ok := r.(io.ReadCloser); ok {
+			return rc, nil
+		}
+		return io.NopCloser(r), nil
+	}
+}
+
+// contentLength returns the remaining length of the body if it is known without reading it, otherwise -1
+func contentLength(body io.Reader) int64 {
+	switch b := body.(type) {
+	case interface{ Len() int }:
+		return int64(b.Len())
+	case *os.File:
+		info, err := b.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return -1
+		}
+		offset, err := b.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		return info.Size() - offset
+	default:
+		return -1
+	}
+}
+
+// letterBody returns the body to save it into a letter. Streamed bodies are read again up to the given limit,
+// so a large upload is never loaded into the memory, truncated is set if the body is longer than the limit
+func (r *Request) letterBody(limit int64) (body []byte, truncated bool, err error) {
+	if r.bodyFactory == nil {
+		return r.body, false, nil
+	}
+	if r.bodyOnce {
+		return nil, false, ErrBodyNotRewindable
+	}
+
+	reader, err := r.openBody()
+	if err != nil {
+		return nil, false, err
+	}
+	defer reader.Close()
+
+	body, err = io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(body)) > limit {
+		return body[:limit], true, nil
+	}
+	return body, false, nil
+}
+
+// attemptContext returns the context of a single attempt
+func (r *Request) attemptContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, r.timeout)
+}
+
+// snapshot returns a deep copy of the request that is used by a single send.
+// Attempts never modify the request the caller built, so a request can be sent many times and from many goroutines
+func (r *Request) snapshot() (*Request, error) {
+	snapshot := *r
+	snapshot.body = append([]byte(nil), r.body...)
+	snapshot.headers = r.headers.Clone()
+	if snapshot.headers == nil {
+		snapshot.headers = make(http.Header)
+	}
+	snapshot.query = make(map[string][]string, len(r.query))
+	for key, values := range r.query {
+		snapshot.query[key] = append([]string(nil), values...)
+	}
+	snapshot.manipulators = append([]func(r *http.Request){}, r.manipulators...)
+	snapshot.tags = make(map[string]string, len(r.tags))
+	for key, value := range r.tags {
+		snapshot.tags[key] = value
+	}
+	snapshot.attempts = &attemptTracker{}
+
+	if !r.idempotent {
+		return &snapshot, nil
+	}
+
+	if r.idempotencyKey != "" {
+		snapshot.headers.Set(_idempotencyKeyHeader, r.idempotencyKey)
+	} else if snapshot.headers.Get(_idempotencyKeyHeader) == "" {
+		key, err := newUUID()
+		if err != nil {
+			return nil, err
+		}
+		snapshot.headers.Set(_idempotencyKeyHeader, key)
+	}
+
+	return &snapshot, nil
+}
+
+// attemptTracker records the attempts of a single send
+type attemptTracker struct {
+	mu    sync.Mutex
+	count int
+	first time.Time
+	last  time.Time
+}
+
+func (t *attemptTracker) record() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if t.count == 0 {
+		t.first = now
+	}
+	t.last = now
+	t.count++
+}
+
+func (t *attemptTracker) stats() (count int, first, last time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.count, t.first, t.last
+}
+
+// newUUID generates a random version 4 uuid
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
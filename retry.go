@@ -0,0 +1,250 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrRetryDeadline is reported when the next attempt could not be sent before the context deadline
+	ErrRetryDeadline = fmt.Errorf("retry would exceed the context deadline: %w", context.DeadlineExceeded)
+	// ErrRetriesExhausted is reported when the last allowed attempt still failed with a transient error
+	ErrRetriesExhausted = errors.New("retries exhausted")
+	// ErrNotRetryable is reported when a request that can not be retried, such as a post, failed with a transient error
+	ErrNotRetryable = errors.New("request is not retryable")
+	// ErrAttemptTimeout is reported when a single attempt exceeds the timeout of the request
+	ErrAttemptTimeout = errors.New("attempt timed out")
+)
+
+// RetryError is returned when the client gives up a request that has failed with a retryable outcome or whose context is done.
+// Use errors.Is with ErrRetriesExhausted, ErrNotRetryable, ErrRetryDeadline, ErrRetryBudgetExhausted or context.Canceled to find out why the client gave up,
+// errors.Is and errors.As also match the error of the last attempt
+type RetryError struct {
+	// Attempts is the number of attempts that were sent
+	Attempts int
+	// StatusCode is the status code of the last response, zero if the last attempt has no response
+	StatusCode int
+	// LastErr is the transport error of the last attempt, nil if the last attempt has a response
+	LastErr error
+	// Err is the reason why the client stopped retrying
+	Err error
+}
+
+func (e *RetryError) Error() string {
+	if e.LastErr != nil {
+		return fmt.Sprintf("request gave up after %d attempts: %v, last error: %v", e.Attempts, e.Err, e.LastErr)
+	}
+	return fmt.Sprintf("request gave up after %d attempts with status %d: %v", e.Attempts, e.StatusCode, e.Err)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error of the last attempt matches the target
+func (e *RetryError) Is(target error) bool {
+	return e.LastErr != nil && errors.Is(e.LastErr, target)
+}
+
+// As finds the first error in the last attempt's error chain that matches the target
+func (e *RetryError) As(target interface{}) bool {
+	return e.LastErr != nil && errors.As(e.LastErr, target)
+}
+
+// RetryPolicy decides whether a request should be sent again and how long to wait before the next attempt.
+// attempt is the number of the attempt that has just finished, starting from 1
+type RetryPolicy interface {
+	// ShouldRetry reports whether the request should be sent again after the given attempt
+	ShouldRetry(attempt int, res *http.Response, err error) bool
+	// Delay returns the duration to wait before sending the next attempt
+	Delay(attempt int, res *http.Response, err error) time.Duration
+}
+
+// NewConstantRetryPolicy create a retry policy that waits the same interval between every attempt
+func NewConstantRetryPolicy(maxRetry int, interval time.Duration) RetryPolicy {
+	return &constantRetryPolicy{
+		retryLimit: retryLimit{maxRetry: maxRetry},
+		interval:   interval,
+	}
+}
+
+// NewLinearRetryPolicy create a retry policy that increases the interval by the given amount on every attempt
+func NewLinearRetryPolicy(maxRetry int, interval time.Duration) RetryPolicy {
+	return &linearRetryPolicy{
+		retryLimit: retryLimit{maxRetry: maxRetry},
+		interval:   interval,
+	}
+}
+
+// NewExponentialRetryPolicy create a retry policy that multiplies the interval by the multiplier on every attempt
+func NewExponentialRetryPolicy(maxRetry int, interval time.Duration, multiplier float64) RetryPolicy {
+	return &exponentialRetryPolicy{
+		retryLimit: retryLimit{maxRetry: maxRetry},
+		interval:   interval,
+		multiplier: multiplier,
+	}
+}
+
+// NewDecorrelatedJitterRetryPolicy create a retry policy that waits a random duration between base and
+// three times the previous upper bound, never exceeding the given cap.
+// The previous bound is derived from the attempt number so the policy can be shared between requests
+func NewDecorrelatedJitterRetryPolicy(maxRetry int, base, cap time.Duration) RetryPolicy {
+	return &decorrelatedJitterRetryPolicy{
+		retryLimit: retryLimit{maxRetry: maxRetry},
+		base:       base,
+		cap:        cap,
+	}
+}
+
+// retryLimit retries retryable responses until the max retry count is reached
+type retryLimit struct {
+	maxRetry int
+}
+
+func (l retryLimit) ShouldRetry(attempt int, res *http.Response, err error) bool {
+	return attempt <= l.maxRetry && isRetryable(res, err)
+}
+
+type constantRetryPolicy struct {
+	retryLimit
+	interval time.Duration
+}
+
+func (p *constantRetryPolicy) Delay(attempt int, res *http.Response, err error) time.Duration {
+	return p.interval
+}
+
+type linearRetryPolicy struct {
+	retryLimit
+	interval time.Duration
+}
+
+func (p *linearRetryPolicy) Delay(attempt int, res *http.Response, err error) time.Duration {
+	return p.interval * time.Duration(attempt)
+}
+
+type exponentialRetryPolicy struct {
+	retryLimit
+	interval   time.Duration
+	multiplier float64
+}
+
+func (p *exponentialRetryPolicy) Delay(attempt int, res *http.Response, err error) time.Duration {
+	computedInterval := float64(p.interval.Milliseconds()) * math.Pow(p.multiplier, float64(attempt))
+	return time.Millisecond * time.Duration(computedInterval)
+}
+
+type decorrelatedJitterRetryPolicy struct {
+	retryLimit
+	base time.Duration
+	cap  time.Duration
+}
+
+func (p *decorrelatedJitterRetryPolicy) Delay(attempt int, res *http.Response, err error) time.Duration {
+	upper := float64(p.base) * math.Pow(3, float64(attempt))
+	if upper > float64(p.cap) {
+		upper = float64(p.cap)
+	}
+	if upper <= float64(p.base) {
+		return time.Duration(upper)
+	}
+
+	return p.base + time.Duration(rand.Int63n(int64(upper)-int64(p.base)))
+}
+
+// wait blocks until the given delay passes or the context is done.
+// It does not wait at all if the delay would end after the context deadline
+func wait(ctx context.Context, delay time.Duration) error {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		return ErrRetryDeadline
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return ErrRetryDeadline
+		}
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func isRetryable(res *http.Response, err error) bool {
+	if err != nil {
+		return isTransientError(err)
+	}
+	return res != nil && (res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500 && res.StatusCode <= 599)
+}
+
+// parseRetryAfter reads the Retry-After header of 429 and 503 responses.
+// The header can either be delta-seconds or an http date
+func parseRetryAfter(res *http.Response) (time.Duration, bool) {
+	if res == nil || (res.StatusCode != http.StatusTooManyRequests && res.StatusCode != http.StatusServiceUnavailable) {
+		return 0, false
+	}
+
+	retryAfter := res.Header.Get("Retry-After")
+	if retryAfter == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(retryAfter); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(retryAfter)
+	if err != nil {
+		return 0, false
+	}
+	if delay := time.Until(date); delay > 0 {
+		return delay, true
+	}
+	return 0, true
+}
+
+// isTransientError reports whether the transport error is likely to disappear when the request is sent again,
+// such as timeouts, refused or reset connections and dns failures. Cancelled contexts are never transient
+func isTransientError(err error) bool {
+	if errors.Is(err, ErrAttemptTimeout) {
+		return true
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,106 @@
+package client
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRetryBudgetExhausted is reported when the retry budget of the client does not allow another retry
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// RetryBudget limits the retries of a client to a percentage of its recent requests,
+// so many callers retrying at once can not multiply the traffic of a struggling upstream.
+// A minimum number of retries per second is always allowed to keep low traffic clients retrying
+type RetryBudget struct {
+	mu           sync.Mutex
+	ratio        float64
+	minPerSecond int
+	buckets      []retryBudgetBucket
+	stats        RetryBudgetStats
+	now          func() time.Time
+}
+
+// RetryBudgetStats are the counters of a retry budget since it is created
+type RetryBudgetStats struct {
+	// Requests is the number of requests sent through the budget
+	Requests uint64
+	// Retries is the number of retries the budget allowed
+	Retries uint64
+	// Rejected is the number of retries the budget rejected
+	Rejected uint64
+}
+
+// retryBudgetBucket holds the counters of a single second
+type retryBudgetBucket struct {
+	second   int64
+	requests int
+	retries  int
+}
+
+// NewRetryBudget create a retry budget that allows retries up to the given percent of the requests
+// sent in the last window, plus minPerSecond retries for every second of the window
+func NewRetryBudget(percent float64, minPerSecond int, window time.Duration) *RetryBudget {
+	seconds := int(window / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	return &RetryBudget{
+		ratio:        percent / 100,
+		minPerSecond: minPerSecond,
+		buckets:      make([]retryBudgetBucket, seconds),
+		now:          time.Now,
+	}
+}
+
+// Stats returns the counters of the budget
+func (b *RetryBudget) Stats() RetryBudgetStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stats
+}
+
+// recordRequest deposits a request into the budget
+func (b *RetryBudget) recordRequest() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.bucket().requests++
+	b.stats.Requests++
+}
+
+// allowRetry withdraws a retry from the budget if there is enough budget left
+func (b *RetryBudget) allowRetry() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	current := b.bucket()
+	var requests, retries int
+	for _, bucket := range b.buckets {
+		if bucket.second > current.second-int64(len(b.buckets)) {
+			requests += bucket.requests
+			retries += bucket.retries
+		}
+	}
+
+	allowed := float64(b.minPerSecond*len(b.buckets)) + b.ratio*float64(requests)
+	if float64(retries) >= allowed {
+		b.stats.Rejected++
+		return false
+	}
+
+	current.retries++
+	b.stats.Retries++
+	return true
+}
+
+// bucket returns the bucket of the current second, the caller must hold the lock
+func (b *RetryBudget) bucket() *retryBudgetBucket {
+	second := b.now().Unix()
+	bucket := &b.buckets[second%int64(len(b.buckets))]
+	if bucket.second != second {
+		*bucket = retryBudgetBucket{second: second}
+	}
+	return bucket
+}
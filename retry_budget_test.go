@@ -0,0 +1,66 @@
+package client_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bilginyuksel/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDo_RetryBudgetExhausted_StopRetryingAndReturnErr(t *testing.T) {
+	var count int
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		count++
+		rw.WriteHeader(500)
+	}))
+
+	budget := client.NewRetryBudget(0, 0, time.Second)
+	cli := client.New(client.WithHost(s.URL), client.WithRetry(3, time.Millisecond), client.WithRetryBudget(budget))
+	_, err := cli.Do(ctx, cli.NewRequest())
+
+	var retryErr *client.RetryError
+	assert.True(t, errors.As(err, &retryErr))
+	assert.True(t, errors.Is(err, client.ErrRetryBudgetExhausted))
+	assert.Equal(t, 500, retryErr.StatusCode)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, client.RetryBudgetStats{Requests: 1, Rejected: 1}, budget.Stats())
+}
+
+func TestDo_RetryBudget_LimitRetriesToPercentOfRequests(t *testing.T) {
+	var count int
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		count++
+		rw.WriteHeader(500)
+	}))
+
+	budget := client.NewRetryBudget(50, 0, time.Minute)
+	cli := client.New(client.WithHost(s.URL), client.WithRetry(1, time.Millisecond), client.WithRetryBudget(budget))
+	for i := 0; i < 10; i++ {
+		_, _ = cli.Do(ctx, cli.NewRequest())
+	}
+
+	stats := budget.Stats()
+	assert.Equal(t, uint64(10), stats.Requests)
+	assert.Equal(t, uint64(5), stats.Retries)
+	assert.Equal(t, uint64(5), stats.Rejected)
+	assert.Equal(t, 15, count)
+}
+
+func TestDo_RetryBudgetMinPerSecond_AllowRetriesWithoutRequests(t *testing.T) {
+	var count int
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		count++
+		rw.WriteHeader(500)
+	}))
+
+	budget := client.NewRetryBudget(0, 2, time.Second)
+	cli := client.New(client.WithHost(s.URL), client.WithRetry(5, time.Millisecond), client.WithRetryBudget(budget))
+	_, err := cli.Do(ctx, cli.NewRequest())
+
+	assert.True(t, errors.Is(err, client.ErrRetryBudgetExhausted))
+	assert.Equal(t, 3, count)
+}
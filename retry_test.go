@@ -0,0 +1,314 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/bilginyuksel/client"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	testCases := []struct {
+		scenario       string
+		givenPolicy    client.RetryPolicy
+		expectedDelays []time.Duration
+	}{
+		{
+			scenario:       "constant",
+			givenPolicy:    client.NewConstantRetryPolicy(3, 100*time.Millisecond),
+			expectedDelays: []time.Duration{100 * time.Millisecond, 100 * time.Millisecond, 100 * time.Millisecond},
+		},
+		{
+			scenario:       "linear",
+			givenPolicy:    client.NewLinearRetryPolicy(3, 100*time.Millisecond),
+			expectedDelays: []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond},
+		},
+		{
+			scenario:       "exponential",
+			givenPolicy:    client.NewExponentialRetryPolicy(3, 100*time.Millisecond, 2),
+			expectedDelays: []time.Duration{200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			for i, expectedDelay := range tc.expectedDelays {
+				assert.Equal(t, expectedDelay, tc.givenPolicy.Delay(i+1, nil, nil))
+			}
+		})
+	}
+}
+
+func TestDecorrelatedJitterRetryPolicy_Delay_StayBetweenBaseAndCap(t *testing.T) {
+	policy := client.NewDecorrelatedJitterRetryPolicy(10, 10*time.Millisecond, 200*time.Millisecond)
+
+	for attempt := 1; attempt <= 10; attempt++ {
+		delay := policy.Delay(attempt, nil, nil)
+		assert.GreaterOrEqual(t, delay, 10*time.Millisecond)
+		assert.LessOrEqual(t, delay, 200*time.Millisecond)
+	}
+}
+
+func TestRetryPolicy_ShouldRetry(t *testing.T) {
+	policy := client.NewConstantRetryPolicy(2, time.Millisecond)
+
+	assert.True(t, policy.ShouldRetry(1, &http.Response{StatusCode: 503}, nil))
+	assert.True(t, policy.ShouldRetry(2, &http.Response{StatusCode: 500}, nil))
+	assert.False(t, policy.ShouldRetry(3, &http.Response{StatusCode: 500}, nil))
+	assert.True(t, policy.ShouldRetry(1, &http.Response{StatusCode: 429}, nil))
+	assert.False(t, policy.ShouldRetry(1, &http.Response{StatusCode: 404}, nil))
+}
+
+func TestDo_WithRetryPolicy_UseGivenPolicy(t *testing.T) {
+	var count int
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		count++
+		rw.WriteHeader(500)
+	}))
+
+	cli := client.New(client.WithHost(s.URL), client.WithRetryPolicy(client.NewLinearRetryPolicy(5, time.Millisecond)))
+	_, _ = cli.Do(ctx, cli.NewRequest())
+
+	assert.Equal(t, 6, count)
+}
+
+func TestDo_BackoffExceedsContextDeadline_ReturnRetryDeadlineErrWithoutWaiting(t *testing.T) {
+	var count int
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		count++
+		rw.WriteHeader(500)
+	}))
+
+	cli := client.New(client.WithHost(s.URL), client.WithRetryPolicy(client.NewConstantRetryPolicy(3, time.Second)))
+	timeoutCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+
+	startTime := time.Now()
+	_, err := cli.Do(timeoutCtx, cli.NewRequest())
+
+	var retryErr *client.RetryError
+	assert.True(t, errors.As(err, &retryErr))
+	assert.True(t, errors.Is(err, client.ErrRetryDeadline))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, 1, retryErr.Attempts)
+	assert.Equal(t, 500, retryErr.StatusCode)
+	assert.Equal(t, 1, count)
+	assert.Less(t, time.Since(startTime), 200*time.Millisecond)
+}
+
+func TestDo_ContextCancelledDuringBackoff_ReturnImmediately(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(500)
+	}))
+
+	cli := client.New(client.WithHost(s.URL), client.WithRetryPolicy(client.NewConstantRetryPolicy(3, time.Second)))
+	cancelCtx, cancel := context.WithCancel(ctx)
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	startTime := time.Now()
+	_, err := cli.Do(cancelCtx, cli.NewRequest())
+
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.False(t, errors.Is(err, client.ErrRetryDeadline))
+	assert.Less(t, time.Since(startTime), time.Second)
+}
+
+func TestDo_DeadlineExceededDuringAttempt_ReturnRetryDeadlineErr(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer s.Close()
+
+	cli := client.New(client.WithHost(s.URL), client.WithRetry(3, time.Millisecond))
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	_, err := cli.Do(timeoutCtx, cli.NewRequest())
+
+	var retryErr *client.RetryError
+	assert.True(t, errors.As(err, &retryErr))
+	assert.True(t, errors.Is(err, client.ErrRetryDeadline))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, 1, retryErr.Attempts)
+}
+
+func TestDo_ContextCancelledDuringAttempt_ReturnCanceledRetryErr(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer s.Close()
+
+	cli := client.New(client.WithHost(s.URL), client.WithRetry(3, time.Millisecond))
+	cancelCtx, cancel := context.WithCancel(ctx)
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	_, err := cli.Do(cancelCtx, cli.NewRequest())
+
+	var retryErr *client.RetryError
+	assert.True(t, errors.As(err, &retryErr))
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.False(t, errors.Is(err, client.ErrRetryDeadline))
+}
+
+func TestDo_ServerClosesConnection_RetryAndSaveRequestToDeadLetter(t *testing.T) {
+	var count int32
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		conn, _, _ := rw.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+
+	mockDeadLetter := client.NewMockDeadLetter(gomock.NewController(t))
+	mockDeadLetter.EXPECT().Save(gomock.Any()).Times(1)
+
+	cli := client.New(client.WithHost(s.URL), client.WithDeadLetter(mockDeadLetter), client.WithRetry(2, time.Millisecond))
+	_, err := cli.Do(ctx, cli.NewRequest().Path("/test"))
+
+	var retryErr *client.RetryError
+	assert.True(t, errors.As(err, &retryErr))
+	assert.True(t, errors.Is(err, client.ErrRetriesExhausted))
+	assert.Equal(t, 3, retryErr.Attempts)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&count))
+}
+
+func TestDo_DeadlineExceededDuringRetry_SaveRequestToDeadLetter(t *testing.T) {
+	var count int32
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) == 1 {
+			rw.WriteHeader(500)
+			return
+		}
+		<-r.Context().Done()
+	}))
+	defer s.Close()
+
+	var letter *client.Letter
+	mockDeadLetter := client.NewMockDeadLetter(gomock.NewController(t))
+	mockDeadLetter.EXPECT().Save(gomock.Any()).Do(func(l *client.Letter) { letter = l }).Times(1)
+
+	cli := client.New(client.WithHost(s.URL), client.WithDeadLetter(mockDeadLetter), client.WithRetry(3, time.Millisecond))
+	timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+
+	_, err := cli.Do(timeoutCtx, cli.NewRequest().Path("/test"))
+
+	assert.True(t, errors.Is(err, client.ErrRetryDeadline))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+	if assert.NotNil(t, letter) {
+		assert.Equal(t, s.URL+"/test", letter.URL)
+		assert.Equal(t, 2, letter.Attempts)
+	}
+}
+
+func TestDo_ConnectionRefused_ReturnRetriesExhaustedErr(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	s.Close()
+
+	cli := client.New(client.WithHost(s.URL), client.WithRetry(1, time.Millisecond))
+	_, err := cli.Do(ctx, cli.NewRequest())
+
+	assert.True(t, errors.Is(err, client.ErrRetriesExhausted))
+	assert.True(t, errors.Is(err, syscall.ECONNREFUSED))
+}
+
+func TestDo_NonRetryableRequestConnectionRefused_ReturnNotRetryableErrAndSaveRequestToDeadLetter(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	s.Close()
+
+	mockDeadLetter := client.NewMockDeadLetter(gomock.NewController(t))
+	mockDeadLetter.EXPECT().Save(gomock.Any()).Times(1)
+
+	cli := client.New(client.WithHost(s.URL), client.WithDeadLetter(mockDeadLetter), client.WithRetry(3, time.Millisecond))
+	_, err := cli.Do(ctx, cli.NewRequest().Method(http.MethodPost))
+
+	var retryErr *client.RetryError
+	assert.True(t, errors.As(err, &retryErr))
+	assert.True(t, errors.Is(err, client.ErrNotRetryable))
+	assert.False(t, errors.Is(err, client.ErrRetriesExhausted))
+	assert.True(t, errors.Is(err, syscall.ECONNREFUSED))
+	assert.Equal(t, 1, retryErr.Attempts)
+}
+
+func TestDo_NonTransientTransportError_DoNotRetry(t *testing.T) {
+	cli := client.New(client.WithHost("ftp://localhost:3000"), client.WithRetry(3, time.Second))
+
+	startTime := time.Now()
+	_, err := cli.Do(ctx, cli.NewRequest())
+
+	var retryErr *client.RetryError
+	assert.NotNil(t, err)
+	assert.False(t, errors.As(err, &retryErr))
+	assert.Less(t, time.Since(startTime), time.Second)
+}
+
+func TestDo_RetryAfterHeader_WaitServerProvidedDuration(t *testing.T) {
+	testCases := []struct {
+		scenario         string
+		givenStatusCode  int
+		givenRetryAfter  string
+		expectedMinDelay time.Duration
+		expectedMaxDelay time.Duration
+	}{
+		{
+			scenario:         "429 with delta seconds",
+			givenStatusCode:  http.StatusTooManyRequests,
+			givenRetryAfter:  "0",
+			expectedMaxDelay: 500 * time.Millisecond,
+		},
+		{
+			scenario:         "503 with http date in the past",
+			givenStatusCode:  http.StatusServiceUnavailable,
+			givenRetryAfter:  time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat),
+			expectedMaxDelay: 500 * time.Millisecond,
+		},
+		{
+			scenario:         "429 with delta seconds capped by max retry after",
+			givenStatusCode:  http.StatusTooManyRequests,
+			givenRetryAfter:  "120",
+			expectedMinDelay: 100 * time.Millisecond,
+			expectedMaxDelay: 500 * time.Millisecond,
+		},
+		{
+			scenario:         "429 without header falls back to the retry policy",
+			givenStatusCode:  http.StatusTooManyRequests,
+			expectedMinDelay: time.Second,
+			expectedMaxDelay: 2 * time.Second,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			var capturedTimes []time.Time
+			s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				capturedTimes = append(capturedTimes, time.Now())
+				if len(capturedTimes) > 1 {
+					rw.WriteHeader(200)
+					return
+				}
+				if tc.givenRetryAfter != "" {
+					rw.Header().Set("Retry-After", tc.givenRetryAfter)
+				}
+				rw.WriteHeader(tc.givenStatusCode)
+			}))
+
+			cli := client.New(client.WithHost(s.URL),
+				client.WithRetryPolicy(client.NewConstantRetryPolicy(1, time.Second)),
+				client.WithMaxRetryAfter(100*time.Millisecond))
+			res, err := cli.Do(ctx, cli.NewRequest())
+
+			assert.Nil(t, err)
+			assert.Equal(t, 200, res.StatusCode)
+			assert.Len(t, capturedTimes, 2)
+			assert.GreaterOrEqual(t, capturedTimes[1].Sub(capturedTimes[0]), tc.expectedMinDelay)
+			assert.Less(t, capturedTimes[1].Sub(capturedTimes[0]), tc.expectedMaxDelay)
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package client
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrStoreLocked is returned when a dead letter store is opened while another process or store value has it open
+var ErrStoreLocked = errors.New("dead letter store is used by another process")
+
+// lockStore takes the exclusive lock of the store in the given path, the lock is held until the returned file is closed.
+// Stores replace their files when letters are removed, so a second writer would keep appending to a deleted file
+func lockStore(path string) (*os.File, error) {
+	file, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
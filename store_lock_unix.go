@@ -0,0 +1,17 @@
+//go:build !windows && !plan9 && !js
+// +build !windows,!plan9,!js
+
+package client
+
+import (
+	"os"
+	"syscall"
+)
+
+func lockFile(file *os.File) error {
+	err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return ErrStoreLocked
+	}
+	return err
+}